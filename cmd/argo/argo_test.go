@@ -1,16 +1,21 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/mresvanis/argo/pkg/registry"
+	"github.com/mresvanis/argo/pkg/watch"
 )
 
 var (
-	testcfg *Config
-	testreg registry.Registrar
+	testcfg     *Config
+	testreg     registry.Registrar
+	testwatcher watch.Watcher
 )
 
 func TestMain(m *testing.M) {
@@ -24,12 +29,15 @@ func TestMain(m *testing.M) {
 		panic(err)
 	}
 
-	testreg = registry.NewRegistry("./testdata/argo_test.db")
+	testreg = registry.NewRegistry("./testdata/argo_test.db", testcfg.logger("reg"))
 	if err := testreg.Open(); err != nil {
 		panic(err)
 	}
 	defer testreg.Close()
 
+	testwatcher = watch.New(pollInterval, testcfg.logger("watch"))
+	defer testwatcher.Close()
+
 	result := m.Run()
 	os.Exit(result)
 }
@@ -39,3 +47,121 @@ func assertEq(a, b interface{}, t *testing.T) {
 		t.Fatalf("Expected %#v and %#v to be equal", a, b)
 	}
 }
+
+// newTestRegistry opens a registry in a temporary directory, for tests that update offsets. The
+// returned function closes and removes it.
+func newTestRegistry(t *testing.T) (registry.Registrar, func()) {
+	dir, err := ioutil.TempDir("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg := registry.NewRegistry(filepath.Join(dir, "argo.db"), nil)
+	if err := reg.Open(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return reg, func() {
+		reg.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// withoutTimes returns the events with their read-time dependent fields and batch id zeroed, for
+// comparisons.
+func withoutTimes(events []Event) []Event {
+	res := make([]Event, len(events))
+	for i, e := range events {
+		e.Timestamp = time.Time{}
+		e.Meta.Ingested = time.Time{}
+		e.batch = 0
+		e.id = ""
+		res[i] = e
+	}
+	return res
+}
+
+// statsWithoutTimes returns the stats with their file and time dependent fields zeroed, for
+// comparisons.
+func statsWithoutTimes(s InputStats) InputStats {
+	s.Inode = 0
+	s.LastRead = time.Time{}
+	s.LastAck = time.Time{}
+	return s
+}
+
+// testRun is an input started by a test, with the channels it sends its batches to and receives
+// their acks from.
+type testRun struct {
+	input Input
+	out   chan []Event
+	ack   chan Ack
+	done  <-chan struct{}
+}
+
+// startInput starts the input with an output that buffers the specified number of batches. The
+// acks are buffered, so that a test can send a late ack besides the expected one.
+func startInput(input Input, batches int) *testRun {
+	r := &testRun{
+		input: input,
+		out:   make(chan []Event, batches),
+		ack:   make(chan Ack, 2),
+	}
+	r.done = async(func() { input.Start(r.out, r.ack) })
+
+	return r
+}
+
+// ackLast acks the batch through its last event.
+func (r *testRun) ackLast(events []Event, hasError bool) {
+	r.ack <- NewAck(events[len(events)-1], hasError)
+}
+
+// wait fails the test unless the input terminates in time.
+func (r *testRun) wait(t *testing.T) {
+	waitClosed(r.done, "input did not terminate", t)
+}
+
+// async runs f in a goroutine and returns a channel that is closed once it returns.
+func async(f func()) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	return done
+}
+
+// waitFor fails the test unless the condition is met in time.
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition was not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitClosed fails the test with msg unless done is closed in time.
+func waitClosed(done <-chan struct{}, msg string, t *testing.T) {
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal(msg)
+	}
+}
+
+// harvestOnce reads the file to completion with the configuration, acks the single batch that is
+// sent and returns its events, once the input terminates.
+func harvestOnce(cfg *Config, path string, reg registry.Registrar, t *testing.T) ([]Event, Input) {
+	cfg.once = true
+	r := startInput(NewFileInput(cfg, path, reg, nil), 1)
+
+	events := <-r.out
+	r.ackLast(events, false)
+	r.wait(t)
+
+	return events, r.input
+}
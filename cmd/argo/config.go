@@ -3,8 +3,19 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"net/url"
+	"strings"
 	"time"
+
+	"github.com/mresvanis/argo/pkg/logging"
+	"github.com/mresvanis/argo/pkg/util"
+)
+
+const (
+	longLinesTruncate = "truncate"
+	longLinesSkip     = "skip"
 )
 
 // Config holds the configuration values that argo needs in order to function.
@@ -14,11 +25,81 @@ type Config struct {
 	Host             string   `json:"host"`
 	Timeout          int64    `json:"timeout"`
 	DispatchInterval int64    `json:"dispatch_interval"`
+	BatchSize        int64    `json:"batch_size"`
 	BufferSize       int64    `json:"buffer_size"`
+	AckTimeout       string   `json:"ack_timeout"`
+	ShutdownTimeout  string   `json:"shutdown_timeout"`
+	ReadCompressed   bool     `json:"read_compressed"`
+	FingerprintSize  int64    `json:"fingerprint_size"`
+	MaxLineBytes     int64    `json:"max_line_bytes"`
+	LongLines        string   `json:"long_lines"`
+	Encoding         string   `json:"encoding"`
+
+	// Format of the lines: json, the cri or docker formats of container logs, or container to
+	// detect either per line.
+	Format string `json:"format"`
+
+	Kubernetes KubernetesConfig `json:"kubernetes"`
+
+	// Multiline joins consecutive lines into single events.
+	Multiline MultilineConfig `json:"multiline"`
+
+	// Inputs hold the settings of the files of their paths, over the global ones, which apply to
+	// the files of Paths.
+	Inputs []InputConfig `json:"inputs"`
+
+	Timestamp TimestampConfig `json:"timestamp"`
+
+	// Processors transform the events of every input, in order, before they are dispatched.
+	Processors []ProcessorConfig `json:"processors"`
+
+	// Filter selects the events of every input, before they are processed.
+	Filter
+
+	// Output selects the processed events that are dispatched.
+	Output OutputConfig `json:"output"`
+
+	// MetaConfig holds the fields and tags added to the events of every input.
+	MetaConfig
+
+	// LimitsConfig holds the rate limit, sampling and dedup of every input.
+	LimitsConfig
+
+	// FieldsRoot is the key under which fields are placed, unless FieldsUnderRoot places them at
+	// the top level of the event.
+	FieldsRoot      string `json:"fields_root"`
+	FieldsUnderRoot bool   `json:"fields_under_root"`
+
+	// HTTP configures the server that exposes the metrics and the health of the process.
+	HTTP HTTPConfig `json:"http"`
+
+	// Log configures the logs of argo itself.
+	Log LogConfig `json:"log"`
+
+	// Monitoring configures the events with the metrics of argo itself.
+	Monitoring MonitoringConfig `json:"monitoring"`
 
 	deadtime         time.Duration
 	timeout          time.Duration
 	dispatchInterval time.Duration
+	ackTimeout       time.Duration
+	shutdownTimeout  time.Duration
+	once             bool
+
+	host  *HostMeta
+	agent *AgentMeta
+	pods  PodMetadataProvider
+
+	metrics *Metrics
+	log     *logging.Logger
+
+	// input whose settings were applied to the configuration, if any
+	input *InputConfig
+
+	// path of the configuration file, which is reloaded on SIGHUP and, if watch is set, when it
+	// changes
+	path  string
+	watch bool
 }
 
 // ParseConfig accepts a reader from which to parse the configuration, and returns a valid
@@ -27,40 +108,192 @@ func ParseConfig(r io.Reader) (*Config, error) {
 	cfg := new(Config)
 
 	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
 	err := dec.Decode(cfg)
 	if err != nil {
-		return nil, err
+		return nil, decodeError(err)
 	}
 
-	if len(cfg.Paths) <= 0 {
+	if len(cfg.patterns()) <= 0 {
 		return nil, errors.New("no paths defined")
 	}
 
 	if cfg.Host == "" {
 		return nil, errors.New("host not defined")
 	}
+	if !validURL(cfg.Host) {
+		return nil, fmt.Errorf("invalid host %q, expected an http or https URL", redactURL(cfg.Host))
+	}
 
 	if cfg.DeadTime == "" {
 		cfg.DeadTime = "24h"
 	}
 	cfg.deadtime, err = time.ParseDuration(cfg.DeadTime)
-	if err != nil {
-		return nil, err
+	if err != nil || cfg.deadtime <= 0 {
+		return nil, fmt.Errorf("invalid dead_time %q", cfg.DeadTime)
 	}
 
+	if cfg.Timeout < 0 {
+		return nil, fmt.Errorf("invalid timeout %d", cfg.Timeout)
+	}
 	if cfg.Timeout == 0 {
 		cfg.Timeout = 10
 	}
 	cfg.timeout = time.Duration(cfg.Timeout) * time.Second
 
+	if cfg.DispatchInterval < 0 {
+		return nil, fmt.Errorf("invalid dispatch_interval %d", cfg.DispatchInterval)
+	}
 	if cfg.DispatchInterval == 0 {
 		cfg.DispatchInterval = 5
 	}
 	cfg.dispatchInterval = time.Duration(cfg.DispatchInterval) * time.Second
 
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 128
+	}
+
 	if cfg.BufferSize <= 0 {
 		cfg.BufferSize = 2048
 	}
 
+	if cfg.AckTimeout == "" {
+		cfg.AckTimeout = "2m"
+	}
+	cfg.ackTimeout, err = time.ParseDuration(cfg.AckTimeout)
+	if err != nil || cfg.ackTimeout <= 0 {
+		return nil, fmt.Errorf("invalid ack_timeout %q", cfg.AckTimeout)
+	}
+
+	if cfg.ShutdownTimeout == "" {
+		cfg.ShutdownTimeout = "30s"
+	}
+	cfg.shutdownTimeout, err = time.ParseDuration(cfg.ShutdownTimeout)
+	if err != nil || cfg.shutdownTimeout <= 0 {
+		return nil, fmt.Errorf("invalid shutdown_timeout %q", cfg.ShutdownTimeout)
+	}
+
+	if cfg.FingerprintSize <= 0 {
+		cfg.FingerprintSize = 1024
+	}
+
+	if cfg.MaxLineBytes <= 0 {
+		cfg.MaxLineBytes = 1 << 20
+	}
+
+	switch cfg.LongLines {
+	case "":
+		cfg.LongLines = longLinesTruncate
+	case longLinesTruncate, longLinesSkip:
+	default:
+		return nil, fmt.Errorf("invalid long_lines %q, expected %q or %q", cfg.LongLines, longLinesTruncate, longLinesSkip)
+	}
+
+	if cfg.Encoding == "" {
+		cfg.Encoding = "utf-8"
+	}
+	if _, err := util.LookupEncoding(cfg.Encoding); err != nil {
+		return nil, fmt.Errorf("invalid encoding; %s", err)
+	}
+
+	if cfg.Format == "" {
+		cfg.Format = formatJSON
+	}
+	if !contains(formats, cfg.Format) {
+		return nil, fmt.Errorf("invalid format %q, expected one of %s", cfg.Format, strings.Join(formats, ", "))
+	}
+
+	err = cfg.Kubernetes.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.Multiline.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.Timestamp.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = NewProcessors(cfg.Processors)
+	if err != nil {
+		return nil, fmt.Errorf("invalid processors; %s", err)
+	}
+
+	err = cfg.Filter.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.Output.parse()
+	if err != nil {
+		return nil, fmt.Errorf("output; %s", err)
+	}
+
+	err = cfg.LimitsConfig.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.HTTP.Health.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.Log.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.Monitoring.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.parseInputs()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.validateMeta()
+	if err != nil {
+		return nil, fmt.Errorf("invalid fields; %s", err)
+	}
+
 	return cfg, nil
 }
+
+// decodeError describes an error decoding the configuration by the offending key.
+func decodeError(err error) error {
+	if terr, ok := err.(*json.UnmarshalTypeError); ok && terr.Field != "" {
+		return fmt.Errorf("key %s: expected %s, got %s", terr.Field, terr.Type, terr.Value)
+	}
+	if msg := err.Error(); strings.HasPrefix(msg, "json: unknown field ") {
+		return fmt.Errorf("unknown setting %s", strings.TrimPrefix(msg, "json: unknown field "))
+	}
+	return err
+}
+
+// validURL reports whether s is an absolute http or https URL.
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// encoding returns the encoding of the files of the configuration.
+func (cfg *Config) encoding() util.Encoding {
+	enc, _ := util.LookupEncoding(cfg.Encoding)
+	return enc
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
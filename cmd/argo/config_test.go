@@ -2,11 +2,30 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/mresvanis/argo/pkg/logging"
 )
 
+var testHealth = HealthConfig{
+	MaxAckAge:    "5m",
+	InputTimeout: "5m",
+	maxAckAge:    5 * time.Minute,
+	inputTimeout: 5 * time.Minute,
+}
+
+var testMonitoring = MonitoringConfig{
+	Interval: "30s",
+	Index:    "argo-monitoring",
+	interval: 30 * time.Second,
+}
+
 func TestParseConfig(t *testing.T) {
 	var tests = []struct {
 		json string
@@ -19,12 +38,27 @@ func TestParseConfig(t *testing.T) {
 				Host:             "http://localhost:9200",
 				Paths:            []string{"./some.log"},
 				DispatchInterval: 5,
+				BatchSize:        128,
 				Timeout:          10,
 				DeadTime:         "24h",
 				BufferSize:       2048,
+				AckTimeout:       "2m",
+				ShutdownTimeout:  "30s",
+				FingerprintSize:  1024,
+				MaxLineBytes:     1048576,
+				LongLines:        "truncate",
+				Encoding:         "utf-8",
+				FieldsRoot:       "fields",
+				Format:           "json",
+				Kubernetes:       KubernetesConfig{CacheTTL: "1m", cacheTTL: time.Minute},
+				HTTP:             HTTPConfig{Health: testHealth},
+				Log:              LogConfig{Level: "info", Format: "logfmt", level: logging.InfoLevel},
+				Monitoring:       testMonitoring,
 				dispatchInterval: time.Duration(5) * time.Second,
 				timeout:          time.Duration(10) * time.Second,
 				deadtime:         time.Duration(86400) * time.Second,
+				ackTimeout:       2 * time.Minute,
+				shutdownTimeout:  30 * time.Second,
 			},
 			nil,
 		}, {
@@ -33,12 +67,27 @@ func TestParseConfig(t *testing.T) {
 				Host:             "http://localhost:9200",
 				Paths:            []string{"./some.log"},
 				DispatchInterval: 5,
+				BatchSize:        128,
 				Timeout:          15,
 				DeadTime:         "24h",
 				BufferSize:       2048,
+				AckTimeout:       "2m",
+				ShutdownTimeout:  "30s",
+				FingerprintSize:  1024,
+				MaxLineBytes:     1048576,
+				LongLines:        "truncate",
+				Encoding:         "utf-8",
+				FieldsRoot:       "fields",
+				Format:           "json",
+				Kubernetes:       KubernetesConfig{CacheTTL: "1m", cacheTTL: time.Minute},
+				HTTP:             HTTPConfig{Health: testHealth},
+				Log:              LogConfig{Level: "info", Format: "logfmt", level: logging.InfoLevel},
+				Monitoring:       testMonitoring,
 				dispatchInterval: time.Duration(5) * time.Second,
 				timeout:          time.Duration(15) * time.Second,
 				deadtime:         time.Duration(86400) * time.Second,
+				ackTimeout:       2 * time.Minute,
+				shutdownTimeout:  30 * time.Second,
 			},
 			nil,
 		}, {
@@ -47,12 +96,27 @@ func TestParseConfig(t *testing.T) {
 				Host:             "http://localhost:9200",
 				Paths:            []string{"./some.log"},
 				DispatchInterval: 5,
+				BatchSize:        128,
 				Timeout:          10,
 				DeadTime:         "12h",
 				BufferSize:       2048,
+				AckTimeout:       "2m",
+				ShutdownTimeout:  "30s",
+				FingerprintSize:  1024,
+				MaxLineBytes:     1048576,
+				LongLines:        "truncate",
+				Encoding:         "utf-8",
+				FieldsRoot:       "fields",
+				Format:           "json",
+				Kubernetes:       KubernetesConfig{CacheTTL: "1m", cacheTTL: time.Minute},
+				HTTP:             HTTPConfig{Health: testHealth},
+				Log:              LogConfig{Level: "info", Format: "logfmt", level: logging.InfoLevel},
+				Monitoring:       testMonitoring,
 				dispatchInterval: time.Duration(5) * time.Second,
 				timeout:          time.Duration(10) * time.Second,
 				deadtime:         time.Duration(43200) * time.Second,
+				ackTimeout:       2 * time.Minute,
+				shutdownTimeout:  30 * time.Second,
 			},
 			nil,
 		}, {
@@ -61,12 +125,27 @@ func TestParseConfig(t *testing.T) {
 				Host:             "http://localhost:9200",
 				Paths:            []string{"./some.log"},
 				DispatchInterval: 5,
+				BatchSize:        128,
 				Timeout:          10,
 				DeadTime:         "24h",
 				BufferSize:       100,
+				AckTimeout:       "2m",
+				ShutdownTimeout:  "30s",
+				FingerprintSize:  1024,
+				MaxLineBytes:     1048576,
+				LongLines:        "truncate",
+				Encoding:         "utf-8",
+				FieldsRoot:       "fields",
+				Format:           "json",
+				Kubernetes:       KubernetesConfig{CacheTTL: "1m", cacheTTL: time.Minute},
+				HTTP:             HTTPConfig{Health: testHealth},
+				Log:              LogConfig{Level: "info", Format: "logfmt", level: logging.InfoLevel},
+				Monitoring:       testMonitoring,
 				dispatchInterval: time.Duration(5) * time.Second,
 				timeout:          time.Duration(10) * time.Second,
 				deadtime:         time.Duration(86400) * time.Second,
+				ackTimeout:       2 * time.Minute,
+				shutdownTimeout:  30 * time.Second,
 			},
 			nil,
 		}, {
@@ -75,14 +154,129 @@ func TestParseConfig(t *testing.T) {
 				Host:             "http://localhost:9200",
 				Paths:            []string{"./some.log"},
 				DispatchInterval: 4,
+				BatchSize:        128,
 				Timeout:          10,
 				DeadTime:         "24h",
 				BufferSize:       2048,
+				AckTimeout:       "2m",
+				ShutdownTimeout:  "30s",
+				FingerprintSize:  1024,
+				MaxLineBytes:     1048576,
+				LongLines:        "truncate",
+				Encoding:         "utf-8",
+				FieldsRoot:       "fields",
+				Format:           "json",
+				Kubernetes:       KubernetesConfig{CacheTTL: "1m", cacheTTL: time.Minute},
+				HTTP:             HTTPConfig{Health: testHealth},
+				Log:              LogConfig{Level: "info", Format: "logfmt", level: logging.InfoLevel},
+				Monitoring:       testMonitoring,
 				dispatchInterval: time.Duration(4) * time.Second,
 				timeout:          time.Duration(10) * time.Second,
 				deadtime:         time.Duration(86400) * time.Second,
+				ackTimeout:       2 * time.Minute,
+				shutdownTimeout:  30 * time.Second,
 			},
 			nil,
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"inputs":[{"paths":["./other.log"],"encoding":"ebcdic"}]}`,
+			nil,
+			errors.New(`invalid inputs[0]; invalid encoding; unsupported encoding "ebcdic"`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"timestamp":{"field":"time","timezone":"Mars/Olympus"}}`,
+			nil,
+			errors.New("invalid timestamp timezone; unknown time zone Mars/Olympus"),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"processors":[{"uppercase":{}}]}`,
+			nil,
+			errors.New(`invalid processors; unknown processor "uppercase"`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"exclude":"level = 'debug'"}`,
+			nil,
+			errors.New("invalid exclude condition; unexpected character '=' at offset 6"),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"output":{"include":"status >"}}`,
+			nil,
+			errors.New("output; invalid include condition; expected field or value but found end of expression at offset 8"),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"fields":{"host.name":"x"},"fields_under_root":true}`,
+			nil,
+			errors.New(`invalid fields; field "host.name" conflicts with the event key "host"`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"format":"syslog"}`,
+			nil,
+			errors.New(`invalid format "syslog", expected one of json, cri, docker, container`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"inputs":[{"paths":["./other.log"],"rate_limit":{"events_per_sec":10,"mode":"block"}}]}`,
+			nil,
+			errors.New(`invalid inputs[0]; invalid rate_limit mode "block", expected "backpressure" or "drop"`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"sampling":{"rate":10}}`,
+			nil,
+			errors.New("invalid sampling rate 10, expected a value from 0 to 1"),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"inputs":[{"paths":["./other.log"],"dedup":{"window":"0s"}}]}`,
+			nil,
+			errors.New(`invalid inputs[0]; invalid dedup window "0s"`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"http":{"health":{"input_timeout":"soon"}}}`,
+			nil,
+			errors.New(`invalid health input_timeout "soon"`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"log":{"levels":{"input":"debug"}}}`,
+			nil,
+			errors.New(`invalid log levels; unknown component "input", expected one of main, harvester, file, out, es, reg, watch, http, monitor`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"log":{"level":"verbose"}}`,
+			nil,
+			errors.New(`invalid log level; unknown level "verbose", expected one of debug, info, warn, error`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"monitoring":{"enabled":true,"index":"Argo-Monitoring"}}`,
+			nil,
+			errors.New(`invalid monitoring index "Argo-Monitoring"`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"dispatch_intreval":5}`,
+			nil,
+			errors.New(`unknown setting "dispatch_intreval"`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"http":{"listne":":9700"}}`,
+			nil,
+			errors.New(`unknown setting "listne"`),
+		}, {
+			`{"host":"http://localhost:9200","paths":"./some.log"}`,
+			nil,
+			errors.New("key paths: expected []string, got string"),
+		}, {
+			`{"host":"localhost:9200","paths":["./some.log"]}`,
+			nil,
+			errors.New(`invalid host "localhost:9200", expected an http or https URL`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"dead_time":"-1h"}`,
+			nil,
+			errors.New(`invalid dead_time "-1h"`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"ack_timeout":"1 minute"}`,
+			nil,
+			errors.New(`invalid ack_timeout "1 minute"`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"shutdown_timeout":"0s"}`,
+			nil,
+			errors.New(`invalid shutdown_timeout "0s"`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"timeout":-5}`,
+			nil,
+			errors.New("invalid timeout -5"),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"dispatch_interval":-1}`,
+			nil,
+			errors.New("invalid dispatch_interval -1"),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"kubernetes":{"cache_ttl":"0s"}}`,
+			nil,
+			errors.New(`invalid kubernetes cache_ttl "0s"`),
+		}, {
+			`{"host":"http://localhost:9200","paths":["./some.log"],"kubernetes":{"api_server":"https://user:secret@"}}`,
+			nil,
+			errors.New(`invalid kubernetes api_server "https://user:REDACTED@", expected an http or https URL`),
 		}, {
 			`{"host":"http://localhost:9200"}`,
 			nil,
@@ -103,3 +297,54 @@ func TestParseConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestParseConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"argo.yaml": `host: ${ARGO_TEST_HOST:-http://localhost:9200}
+paths:
+  - /var/log/app.log
+buffer_size: ${ARGO_TEST_BUFFER}
+include_files: conf.d
+`,
+		"conf.d/nginx.toml": `paths = ["/var/log/nginx/*.log"]
+tags = ["web"]
+`,
+		"conf.d/once.json": `{"dispatch_interval": 1}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	os.Setenv("ARGO_TEST_BUFFER", "50")
+	defer os.Unsetenv("ARGO_TEST_BUFFER")
+
+	cfg, err := parseConfigFile(filepath.Join(dir, "argo.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEq(cfg.Host, "http://localhost:9200", t)
+	assertEq(cfg.Paths, []string{"/var/log/app.log", "/var/log/nginx/*.log"}, t)
+	assertEq(cfg.BufferSize, int64(50), t)
+	assertEq(cfg.Tags, []string{"web"}, t)
+	assertEq(cfg.dispatchInterval, time.Second, t)
+
+	// type errors point at the file and key
+	bad := filepath.Join(dir, "conf.d", "nginx.toml")
+	ioutil.WriteFile(bad, []byte(`buffer_size = "large"`), 0644)
+	_, err = parseConfigFile(filepath.Join(dir, "argo.yaml"))
+	assertEq(err, fmt.Errorf("cannot parse configuration; %s: key buffer_size: expected int64, got string", bad), t)
+
+	os.Unsetenv("ARGO_TEST_BUFFER")
+	_, err = parseConfigFile(filepath.Join(dir, "argo.yaml"))
+	assertEq(err, fmt.Errorf(`cannot parse configuration; %s: key buffer_size: variable "ARGO_TEST_BUFFER" is not set`, filepath.Join(dir, "argo.yaml")), t)
+}
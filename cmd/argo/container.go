@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Formats of the lines of a file.
+const (
+	formatJSON      = "json"
+	formatCRI       = "cri"
+	formatDocker    = "docker"
+	formatContainer = "container" // cri or docker, detected per line
+)
+
+var formats = []string{formatJSON, formatCRI, formatDocker, formatContainer}
+
+// containerLine is a line of a container runtime log file.
+type containerLine struct {
+	Time    time.Time
+	Stream  string
+	Message string
+	Partial bool
+}
+
+// parseContainerLine parses a line of the specified container format.
+func parseContainerLine(format, line string) (containerLine, error) {
+	if format == formatContainer {
+		format = formatCRI
+		if strings.HasPrefix(line, "{") {
+			format = formatDocker
+		}
+	}
+
+	if format == formatDocker {
+		return parseDocker(line)
+	}
+	return parseCRI(line)
+}
+
+// parseCRI parses a line of the CRI format: `<time> <stream> <P|F> <message>`.
+func parseCRI(line string) (containerLine, error) {
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) < 3 {
+		return containerLine{}, fmt.Errorf("invalid cri line")
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return containerLine{}, fmt.Errorf("invalid cri time %q", parts[0])
+	}
+
+	var partial bool
+	switch parts[2] {
+	case "P":
+		partial = true
+	case "F":
+	default:
+		return containerLine{}, fmt.Errorf("invalid cri tag %q", parts[2])
+	}
+
+	cl := containerLine{Time: ts, Stream: parts[1], Partial: partial}
+	if len(parts) == 4 {
+		cl.Message = parts[3]
+	}
+	return cl, nil
+}
+
+// parseDocker parses a line of the docker json-file format, where lines that do not end with a
+// newline have been split by the runtime.
+func parseDocker(line string) (containerLine, error) {
+	var entry struct {
+		Log    string    `json:"log"`
+		Stream string    `json:"stream"`
+		Time   time.Time `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		return containerLine{}, fmt.Errorf("invalid docker line; %s", err)
+	}
+
+	cl := containerLine{Time: entry.Time, Stream: entry.Stream}
+	if strings.HasSuffix(entry.Log, "\n") {
+		cl.Message = strings.TrimSuffix(strings.TrimSuffix(entry.Log, "\n"), "\r")
+	} else {
+		cl.Message = entry.Log
+		cl.Partial = true
+	}
+	return cl, nil
+}
+
+// containerReader turns the lines of a container log into events, reassembling the messages
+// that the runtime split into partial lines. A reassembled event spans the offsets of all its
+// lines, so that it is acknowledged only once complete.
+type containerReader struct {
+	format   string
+	maxBytes int
+
+	pending   bool
+	source    *string
+	line      uint64
+	offset    int64
+	size      int64
+	first     containerLine
+	message   strings.Builder
+	truncated bool
+}
+
+func newContainerReader(format string, maxBytes int64) *containerReader {
+	return &containerReader{format: format, maxBytes: int(maxBytes)}
+}
+
+// add processes a line and returns the event it completes, if any. Lines that cannot be parsed
+// become events of their own, with the line as their message, while a pending partial message
+// waits for its next line.
+func (cr *containerReader) add(source *string, line uint64, offset int64, size int, text string) (Event, bool, error) {
+	cl, err := parseContainerLine(cr.format, text)
+	if err != nil {
+		e := Event{Source: source, Line: line, Offset: offset, size: int64(size)}
+		e.Text = map[string]interface{}{"message": text}
+		return e, true, err
+	}
+
+	if !cr.pending {
+		cr.pending = true
+		cr.source = source
+		cr.line = line
+		cr.offset = offset
+		cr.first = cl
+	}
+	cr.size = offset + int64(size) - cr.offset
+
+	room := cr.maxBytes - cr.message.Len()
+	if room < 0 {
+		room = 0
+	}
+	if len(cl.Message) > room {
+		for room > 0 && !utf8.RuneStart(cl.Message[room]) {
+			room--
+		}
+		cl.Message = cl.Message[:room]
+		cr.truncated = true
+	}
+	cr.message.WriteString(cl.Message)
+
+	if cl.Partial {
+		return Event{}, false, nil
+	}
+	return cr.flush()
+}
+
+// flush returns the pending partial message as an event, if any.
+func (cr *containerReader) flush() (Event, bool, error) {
+	if !cr.pending {
+		return Event{}, false, nil
+	}
+
+	e := Event{Source: cr.source, Line: cr.line, Offset: cr.offset, size: cr.size}
+	e.Timestamp = cr.first.Time
+	e.Stream = cr.first.Stream
+	e.Truncated = cr.truncated
+	e.Text = decodeMessage(cr.message.String())
+
+	cr.reset()
+	return e, true, nil
+}
+
+// oldest returns the offset of the pending partial message, or false if none is pending. The file
+// must not be acked past it, so that the message is read again if it is never completed.
+func (cr *containerReader) oldest() (int64, bool) {
+	if !cr.pending {
+		return 0, false
+	}
+	return cr.offset, true
+}
+
+// reset discards the pending partial message.
+func (cr *containerReader) reset() {
+	cr.pending = false
+	cr.size = 0
+	cr.truncated = false
+	cr.message.Reset()
+}
+
+// decodeMessage decodes a message that is a JSON object, or wraps it as text.
+func decodeMessage(msg string) map[string]interface{} {
+	var text map[string]interface{}
+	if strings.HasPrefix(msg, "{") && json.Unmarshal([]byte(msg), &text) == nil {
+		return text
+	}
+	return map[string]interface{}{"message": msg}
+}
+
+// parsePodPath returns the pod, namespace and container encoded in the name of a Kubernetes
+// container log file: `<pod>_<namespace>_<container>-<container id>.log`.
+func parsePodPath(path string) (*KubernetesMeta, bool) {
+	name := strings.TrimSuffix(filepath.Base(path), ".log")
+
+	parts := strings.SplitN(name, "_", 3)
+	if len(parts) != 3 {
+		return nil, false
+	}
+
+	i := strings.LastIndex(parts[2], "-")
+	if i <= 0 || len(parts[2])-i-1 != 64 {
+		return nil, false
+	}
+
+	k := new(KubernetesMeta)
+	k.Pod.Name = parts[0]
+	k.Namespace = parts[1]
+	k.Container.Name = parts[2][:i]
+	k.Container.ID = parts[2][i+1:]
+	return k, true
+}
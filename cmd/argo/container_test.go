@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testContainerID = strings.Repeat("0123456789abcdef", 4)
+
+// fakePods is a PodMetadataProvider that serves pods from memory and counts the lookups.
+type fakePods struct {
+	pods  map[string]*PodMetadata
+	calls int
+}
+
+func (f *fakePods) PodMetadata(namespace, name string) (*PodMetadata, error) {
+	f.calls++
+
+	pod, ok := f.pods[namespace+"/"+name]
+	if !ok {
+		return nil, fmt.Errorf("pod %s/%s not found", namespace, name)
+	}
+	return pod, nil
+}
+
+func TestParseContainerLine(t *testing.T) {
+	ts := time.Date(2019, 6, 9, 10, 0, 0, 123456789, time.UTC)
+
+	var tests = []struct {
+		format string
+		line   string
+		exp    containerLine
+		err    error
+	}{
+		{
+			formatCRI,
+			`2019-06-09T10:00:00.123456789Z stdout F {"level":"info"}`,
+			containerLine{Time: ts, Stream: "stdout", Message: `{"level":"info"}`},
+			nil,
+		}, {
+			formatCRI,
+			`2019-06-09T10:00:00.123456789Z stderr P part one `,
+			containerLine{Time: ts, Stream: "stderr", Message: "part one ", Partial: true},
+			nil,
+		}, {
+			formatCRI,
+			`2019-06-09T10:00:00.123456789Z stdout F`,
+			containerLine{Time: ts, Stream: "stdout"},
+			nil,
+		}, {
+			formatCRI,
+			`2019-06-09T10:00:00.123456789Z stdout X message`,
+			containerLine{},
+			errors.New(`invalid cri tag "X"`),
+		}, {
+			formatCRI,
+			`yesterday stdout F message`,
+			containerLine{},
+			errors.New(`invalid cri time "yesterday"`),
+		}, {
+			formatDocker,
+			`{"log":"hello\n","stream":"stdout","time":"2019-06-09T10:00:00.123456789Z"}`,
+			containerLine{Time: ts, Stream: "stdout", Message: "hello"},
+			nil,
+		}, {
+			formatDocker,
+			`{"log":"hel","stream":"stdout","time":"2019-06-09T10:00:00.123456789Z"}`,
+			containerLine{Time: ts, Stream: "stdout", Message: "hel", Partial: true},
+			nil,
+		}, {
+			formatContainer,
+			`{"log":"hello\r\n","stream":"stderr","time":"2019-06-09T10:00:00.123456789Z"}`,
+			containerLine{Time: ts, Stream: "stderr", Message: "hello"},
+			nil,
+		}, {
+			formatContainer,
+			`2019-06-09T10:00:00.123456789Z stdout F hello`,
+			containerLine{Time: ts, Stream: "stdout", Message: "hello"},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			cl, err := parseContainerLine(tt.format, tt.line)
+			assertEq(err, tt.err, t)
+			assertEq(cl, tt.exp, t)
+		})
+	}
+}
+
+func TestParsePodPath(t *testing.T) {
+	k, ok := parsePodPath("/var/log/containers/web-7d9f_prod_nginx-proxy-" + testContainerID + ".log")
+	if !ok {
+		t.Fatal("expected the path to be parsed")
+	}
+	assertEq(k.Pod.Name, "web-7d9f", t)
+	assertEq(k.Namespace, "prod", t)
+	assertEq(k.Container.Name, "nginx-proxy", t)
+	assertEq(k.Container.ID, testContainerID, t)
+
+	for _, path := range []string{
+		"/var/log/app.log",
+		"/var/log/containers/web_prod_nginx.log",
+		"/var/log/containers/web_prod_nginx-1234.log",
+	} {
+		if _, ok := parsePodPath(path); ok {
+			t.Fatalf("expected %s not to be parsed", path)
+		}
+	}
+}
+
+func TestContainerReader(t *testing.T) {
+	path := "test.log"
+	lines := []string{
+		`2019-06-09T10:00:00Z stdout P first `,
+		`not a container line`,
+		`2019-06-09T10:00:01Z stdout P second `,
+		`2019-06-09T10:00:02Z stdout F third`,
+	}
+
+	cr := newContainerReader(formatCRI, 12)
+	fi := &FileInput{container: cr}
+
+	var offset int64
+	var events []Event
+	for i, line := range lines {
+		e, ok, _ := cr.add(&path, uint64(i+1), offset, len(line)+1, line)
+		offset += int64(len(line) + 1)
+		if ok {
+			events = append(events, e)
+		}
+
+		// the offset is held at the partial message until it is complete
+		fi.events = events
+		if i < len(lines)-1 {
+			assertEq(fi.ackOffset(), int64(0), t)
+		}
+	}
+
+	assertEq(len(events), 2, t)
+	assertEq(events[0].Text, map[string]interface{}{"message": "not a container line"}, t)
+	assertEq(events[1].Text, map[string]interface{}{"message": "first second"}, t)
+	assertEq(events[1].Truncated, true, t)
+	assertEq(fi.ackOffset(), offset, t)
+}
+
+func TestFileInputContainer(t *testing.T) {
+	content := `2019-06-09T10:00:00Z stdout F {"level":"info","msg":"started"}` + "\n" +
+		`2019-06-09T10:00:01Z stderr P {"level":"error",` + "\n" +
+		`2019-06-09T10:00:01Z stderr F "msg":"split"}` + "\n" +
+		`{"log":"plain text\n","stream":"stdout","time":"2019-06-09T10:00:02Z"}` + "\n" +
+		`not a container line` + "\n" +
+		`2019-06-09T10:00:03Z stdout P unfinished`
+
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "web-1_prod_nginx-"+testContainerID+".log")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pods := &fakePods{pods: map[string]*PodMetadata{
+		"prod/web-1": {UID: "uid-1", Labels: map[string]string{"app": "web"}},
+	}}
+
+	cfg := *testcfg
+	cfg.Format = formatContainer
+	cfg.pods = NewPodCache(pods, time.Minute)
+
+	events, _ := harvestOnce(&cfg, path, reg, t)
+
+	lines := strings.SplitAfter(content, "\n")
+	offsets := make([]int64, len(lines)+1)
+	for i, line := range lines {
+		offsets[i+1] = offsets[i] + int64(len(line))
+	}
+
+	var tests = []struct {
+		line   uint64
+		offset int64
+		size   int64
+		stream string
+		ts     string
+		text   map[string]interface{}
+	}{
+		{1, offsets[0], offsets[1] - offsets[0], "stdout", "2019-06-09T10:00:00Z", map[string]interface{}{"level": "info", "msg": "started"}},
+		{2, offsets[1], offsets[3] - offsets[1], "stderr", "2019-06-09T10:00:01Z", map[string]interface{}{"level": "error", "msg": "split"}},
+		{4, offsets[3], offsets[4] - offsets[3], "stdout", "2019-06-09T10:00:02Z", map[string]interface{}{"message": "plain text"}},
+		{5, offsets[4], offsets[5] - offsets[4], "", "", map[string]interface{}{"message": "not a container line"}},
+		{6, offsets[5], offsets[6] - offsets[5], "stdout", "2019-06-09T10:00:03Z", map[string]interface{}{"message": "unfinished"}},
+	}
+
+	if len(events) != len(tests) {
+		t.Fatalf("expected %d events, got %d", len(tests), len(events))
+	}
+
+	for i, tt := range tests {
+		e := events[i]
+		assertEq(e.Line, tt.line, t)
+		assertEq(e.Offset, tt.offset, t)
+		assertEq(e.size, tt.size, t)
+		assertEq(e.Stream, tt.stream, t)
+		assertEq(e.Text, tt.text, t)
+		if tt.ts != "" {
+			assertEq(e.Timestamp.Format(time.RFC3339), tt.ts, t)
+		}
+
+		assertEq(e.Kubernetes.Pod.Name, "web-1", t)
+		assertEq(e.Kubernetes.Pod.UID, "uid-1", t)
+		assertEq(e.Kubernetes.Namespace, "prod", t)
+		assertEq(e.Kubernetes.Container.Name, "nginx", t)
+		assertEq(e.Kubernetes.Labels, map[string]string{"app": "web"}, t)
+	}
+	assertEq(pods.calls, 1, t)
+
+	offset, _ := reg.GetOffset(path)
+	assertEq(offset, int64(len(content)), t)
+}
+
+func TestPodCache(t *testing.T) {
+	pods := &fakePods{pods: map[string]*PodMetadata{"prod/web-1": {UID: "uid-1"}}}
+	cache := NewPodCache(pods, 50*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		pod, err := cache.PodMetadata("prod", "web-1")
+		assertEq(err, nil, t)
+		assertEq(pod.UID, "uid-1", t)
+
+		_, err = cache.PodMetadata("prod", "gone")
+		assertEq(err, errors.New("pod prod/gone not found"), t)
+	}
+	assertEq(pods.calls, 2, t)
+
+	time.Sleep(60 * time.Millisecond)
+	cache.PodMetadata("prod", "web-1")
+	assertEq(pods.calls, 3, t)
+}
+
+// slowPods is a PodMetadataProvider whose lookups of the pod named slow wait until release is
+// closed.
+type slowPods struct {
+	release chan struct{}
+	calls   int32
+}
+
+func (p *slowPods) PodMetadata(namespace, name string) (*PodMetadata, error) {
+	atomic.AddInt32(&p.calls, 1)
+	if name == "slow" {
+		<-p.release
+	}
+	return &PodMetadata{UID: name}, nil
+}
+
+func TestPodCacheSlowProvider(t *testing.T) {
+	pods := &slowPods{release: make(chan struct{})}
+	cache := NewPodCache(pods, time.Minute)
+
+	var slow [2]*PodMetadata
+	first := async(func() { slow[0], _ = cache.PodMetadata("prod", "slow") })
+	waitFor(t, func() bool { return atomic.LoadInt32(&pods.calls) == 1 })
+	second := async(func() { slow[1], _ = cache.PodMetadata("prod", "slow") })
+
+	// the lookup in flight does not hold up the other pods
+	other := async(func() { cache.PodMetadata("prod", "web-1") })
+	waitClosed(other, "lookup waited for another pod", t)
+
+	close(pods.release)
+	waitClosed(first, "slow lookup did not complete", t)
+	waitClosed(second, "concurrent lookup did not complete", t)
+	assertEq(slow[0].UID, "slow", t)
+	assertEq(slow[1], slow[0], t)
+	assertEq(atomic.LoadInt32(&pods.calls), int32(2), t)
+}
+
+func TestAPIPodProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/prod/pods/web-1" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"metadata":{"name":"web-1","uid":"uid-1","labels":{"app":"web"}}}`)
+	}))
+	defer server.Close()
+
+	provider, err := NewAPIPodProvider(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pod, err := provider.PodMetadata("prod", "web-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEq(pod, &PodMetadata{UID: "uid-1", Labels: map[string]string{"app": "web"}}, t)
+
+	_, err = provider.PodMetadata("prod", "web-2")
+	assertEq(err, errors.New("could not get pod prod/web-2; 404 Not Found"), t)
+}
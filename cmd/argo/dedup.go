@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultDedupWindow    = "10s"
+	defaultDedupMaxEvents = 10000
+)
+
+// DedupConfig collapses the identical events of an input within a window into one event, which
+// counts the repeats. Events are identical if their text is, or the values of Fields if defined.
+type DedupConfig struct {
+	Window string   `json:"window"`
+	Fields []string `json:"fields"`
+
+	// MaxEvents is the number of distinct events held at once; further events are sent as they
+	// are until the window of the held ones ends.
+	MaxEvents int `json:"max_events"`
+
+	window time.Duration
+}
+
+func (dc *DedupConfig) parse() error {
+	if dc.Window == "" {
+		dc.Window = defaultDedupWindow
+	}
+	window, err := time.ParseDuration(dc.Window)
+	if err != nil || window <= 0 {
+		return fmt.Errorf("invalid dedup window %q", dc.Window)
+	}
+	dc.window = window
+
+	if dc.MaxEvents < 0 {
+		return fmt.Errorf("invalid dedup max_events %d", dc.MaxEvents)
+	}
+	if dc.MaxEvents == 0 {
+		dc.MaxEvents = defaultDedupMaxEvents
+	}
+
+	return nil
+}
+
+// duplicate is an event held by the deduplicator along with its repeats.
+type duplicate struct {
+	key   string
+	event Event
+	count int
+	last  time.Time // timestamp of the latest repeat
+	end   int64     // offset past the latest repeat
+	due   time.Time
+}
+
+// deduper holds the events of an input until their window ends, counting their repeats.
+type deduper struct {
+	window time.Duration
+	fields []string
+	max    int
+
+	held  map[string]*duplicate
+	order []*duplicate // by arrival, which is also by due time and offset
+}
+
+func newDeduper(cfg *DedupConfig) *deduper {
+	if cfg == nil {
+		return nil
+	}
+
+	return &deduper{
+		window: cfg.window,
+		fields: cfg.Fields,
+		max:    cfg.MaxEvents,
+		held:   make(map[string]*duplicate),
+	}
+}
+
+// add holds the event, or counts it as a repeat of a held one, and reports whether it did either
+// and whether it was a repeat. Events that are not held should be sent as they are.
+func (d *deduper) add(e Event, now time.Time) (held, repeat bool) {
+	key := d.key(&e)
+	if dup, ok := d.held[key]; ok {
+		dup.count++
+		dup.last = e.Timestamp
+		dup.end = e.Offset + e.size
+		return true, true
+	}
+
+	if len(d.held) >= d.max {
+		return false, false
+	}
+
+	dup := &duplicate{
+		key:   key,
+		event: e,
+		count: 1,
+		last:  e.Timestamp,
+		end:   e.Offset + e.size,
+		due:   now.Add(d.window),
+	}
+	d.held[key] = dup
+	d.order = append(d.order, dup)
+
+	return true, false
+}
+
+// key identifies the event by the values of the key fields or, if it has none of them, its text.
+func (d *deduper) key(e *Event) string {
+	if len(d.fields) > 0 {
+		values := make([]interface{}, len(d.fields))
+		var found bool
+		for i, field := range d.fields {
+			if v, ok := lookupField(e.Text, field); ok {
+				values[i] = v
+				found = true
+			}
+		}
+		if found {
+			key, _ := json.Marshal(values)
+			return string(key)
+		}
+	}
+
+	// maps are encoded with sorted keys, so identical texts have identical keys
+	key, _ := json.Marshal(e.Text)
+	return string(key)
+}
+
+// expired returns the held events whose window has ended by now.
+func (d *deduper) expired(now time.Time) []Event {
+	var n int
+	for n < len(d.order) && !d.order[n].due.After(now) {
+		n++
+	}
+	return d.release(n)
+}
+
+// flush returns all the held events.
+func (d *deduper) flush() []Event {
+	return d.release(len(d.order))
+}
+
+// next returns when the window of the oldest held event ends, or false if none is held.
+func (d *deduper) next() (time.Time, bool) {
+	if len(d.order) == 0 {
+		return time.Time{}, false
+	}
+	return d.order[0].due, true
+}
+
+// oldest returns the offset of the oldest held event, or false if none is held. The file must
+// not be acked past it, so that the held events are read again if they are never sent.
+func (d *deduper) oldest() (int64, bool) {
+	if len(d.order) == 0 {
+		return 0, false
+	}
+	return d.order[0].event.Offset, true
+}
+
+// release removes the first n held events and returns them, recording their repeats. The size of
+// an event with repeats spans up to the latest one.
+func (d *deduper) release(n int) []Event {
+	if n == 0 {
+		return nil
+	}
+
+	events := make([]Event, n)
+	for i, dup := range d.order[:n] {
+		e := dup.event
+		if dup.count > 1 {
+			first, last := e.Timestamp, dup.last
+			e.RepeatCount = dup.count
+			e.FirstTimestamp = &first
+			e.LastTimestamp = &last
+			e.size = dup.end - e.Offset
+		}
+		events[i] = e
+
+		delete(d.held, dup.key)
+	}
+	d.order = append(d.order[:0], d.order[n:]...)
+
+	return events
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDeduper(t *testing.T) {
+	path := "test.log"
+	start := time.Date(2019, 6, 9, 0, 0, 0, 0, time.UTC)
+
+	var offset int64
+	event := func(text string, at time.Duration) Event {
+		e := NewEvent(&path, 1, offset, &text)
+		e.Timestamp = start.Add(at)
+		e.size = int64(len(text) + 1)
+		offset += e.size
+		return e
+	}
+
+	cfg := &DedupConfig{Window: "10s", Fields: []string{"error.code"}, MaxEvents: 2}
+	if err := cfg.parse(); err != nil {
+		t.Fatal(err)
+	}
+	d := newDeduper(cfg)
+
+	add := func(e Event, held, repeat bool) {
+		h, r := d.add(e, e.Timestamp)
+		assertEq(h, held, t)
+		assertEq(r, repeat, t)
+	}
+
+	first := event(`{"error":{"code":500},"message":"backend down"}`, 0)
+	add(first, true, false)
+	add(event(`{"error":{"code":500},"message":"backend still down"}`, time.Second), true, true)
+	last := event(`{"error":{"code":500},"message":"backend down"}`, 2*time.Second)
+	add(last, true, true)
+
+	// without the key fields, events are identical by text
+	other := event(`{"message":"starting"}`, 3*time.Second)
+	add(other, true, false)
+
+	// the held events are limited
+	add(event(`{"message":"listening"}`, 4*time.Second), false, false)
+
+	if offset, ok := d.oldest(); !ok || offset != first.Offset {
+		t.Fatalf("expected the oldest held event at offset %d, got %d", first.Offset, offset)
+	}
+	if next, ok := d.next(); !ok || !next.Equal(start.Add(10*time.Second)) {
+		t.Fatalf("expected the first window to end at 10s, got %s", next)
+	}
+
+	assertEq(len(d.expired(start.Add(9*time.Second))), 0, t)
+
+	expired := d.expired(start.Add(10 * time.Second))
+	assertEq(len(expired), 1, t)
+
+	e := expired[0]
+	assertEq(e.Text, first.Text, t)
+	assertEq(e.RepeatCount, 3, t)
+	assertEq(*e.FirstTimestamp, first.Timestamp, t)
+	assertEq(*e.LastTimestamp, last.Timestamp, t)
+	assertEq(e.Offset+e.size, last.Offset+last.size, t)
+
+	flushed := d.flush()
+	assertEq(len(flushed), 1, t)
+	assertEq(flushed[0].RepeatCount, 0, t)
+	assertEq(flushed[0].size, other.size, t)
+
+	if _, ok := d.oldest(); ok {
+		t.Fatal("expected no held events")
+	}
+}
+
+func TestFileInputDedup(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	f, err := ioutil.TempFile("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	for i := 0; i < 100; i++ {
+		fmt.Fprintln(f, `{"message":"connection refused"}`)
+		if i%50 == 0 {
+			fmt.Fprintf(f, `{"message":"retry %d"}`+"\n", i)
+		}
+	}
+	info, _ := f.Stat()
+	f.Close()
+
+	cfg := *testcfg
+	cfg.Dedup = &DedupConfig{Window: "1m"}
+	if err := cfg.Dedup.parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	events, input := harvestOnce(&cfg, path, reg, t)
+
+	assertEq(len(events), 3, t)
+	assertEq(events[0].Text["message"], "connection refused", t)
+	assertEq(events[0].RepeatCount, 100, t)
+	assertEq(events[1].Text["message"], "retry 0", t)
+	assertEq(events[1].RepeatCount, 0, t)
+	assertEq(events[2].Text["message"], "retry 50", t)
+	assertEq(input.Stats().Repeats, uint64(99), t)
+
+	// the last event sent is not the furthest in the file, which is still acked as a whole
+	offset, err := reg.GetOffset(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEq(offset, info.Size(), t)
+}
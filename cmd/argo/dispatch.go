@@ -5,11 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
-	"os"
+	"math"
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/mresvanis/argo/pkg/logging"
 	"github.com/mresvanis/argo/pkg/util"
 )
 
@@ -24,14 +24,19 @@ type Dispatcher interface {
 type Elasticsearch struct {
 	hosts  []string
 	client *elasticsearch.Client
-	log    *log.Logger
+	log    *logging.Logger
 }
 
-func NewElasticsearchDispatcher(hosts []string) *Elasticsearch {
+func NewElasticsearchDispatcher(hosts []string, log *logging.Logger) *Elasticsearch {
 	es := new(Elasticsearch)
 
 	es.hosts = hosts
-	es.log = log.New(os.Stderr, fmt.Sprintf("[es] %s ", es.hosts), log.LstdFlags)
+
+	redacted := make([]string, len(hosts))
+	for i, host := range hosts {
+		redacted[i] = redactURL(host)
+	}
+	es.log = log.With("hosts", redacted)
 
 	return es
 }
@@ -92,18 +97,18 @@ func (es *Elasticsearch) Send(events []Event) (Ack, error) {
 	if !res.IsError() {
 		var blk *bulkResponse
 		if err := json.NewDecoder(res.Body).Decode(&blk); err != nil {
-			es.log.Printf("failed to parse response body: %s", err.Error())
+			es.log.Error("failed to parse response body", "error", err)
 
 		} else {
 			for _, d := range blk.Items {
 				if d.Index.Status > 201 {
 					numErrors++
-					es.log.Printf("error: [%d]: %s: %s: %s: %s",
-						d.Index.Status,
-						d.Index.Error.Type,
-						d.Index.Error.Reason,
-						d.Index.Error.Cause.Type,
-						d.Index.Error.Cause.Reason,
+					es.log.Error("could not index document",
+						"status", d.Index.Status,
+						"type", d.Index.Error.Type,
+						"reason", d.Index.Error.Reason,
+						"cause_type", d.Index.Error.Cause.Type,
+						"cause_reason", d.Index.Error.Cause.Reason,
 					)
 					continue
 				}
@@ -117,23 +122,23 @@ func (es *Elasticsearch) Send(events []Event) (Ack, error) {
 
 		var raw map[string]interface{}
 		if err := json.NewDecoder(res.Body).Decode(&raw); err != nil {
-			es.log.Printf("failed to parse response body, %s", err.Error())
+			es.log.Error("failed to parse response body", "status", res.StatusCode, "error", err)
 
 		} else {
-			es.log.Printf("error: [%d] %s: %s",
-				res.StatusCode,
-				raw["error"].(map[string]interface{})["type"],
-				raw["error"].(map[string]interface{})["reason"],
+			es.log.Error("bulk request failed",
+				"status", res.StatusCode,
+				"type", raw["error"].(map[string]interface{})["type"],
+				"reason", raw["error"].(map[string]interface{})["reason"],
 			)
 		}
 	}
 
 	dur := time.Since(start)
-	es.log.Printf("indexed [%d] documents with [%d] errors in %s (%.0f docs/sec)",
-		numIndexed,
-		numErrors,
-		dur.Truncate(time.Millisecond),
-		1000.0/float64(dur/time.Millisecond)*float64(numIndexed),
+	es.log.Debug("indexed documents",
+		"indexed", numIndexed,
+		"errors", numErrors,
+		"took", dur.Truncate(time.Millisecond),
+		"docs_per_sec", math.Round(float64(numIndexed)/dur.Seconds()),
 	)
 
 	return NewAck(lastEvent, withErrors), nil
@@ -142,7 +147,14 @@ func (es *Elasticsearch) Send(events []Event) (Ack, error) {
 func prepareBulkPayload(events []Event) (bytes.Buffer, error) {
 	var buf bytes.Buffer
 	for _, event := range events {
-		meta := []byte(fmt.Sprintf(`{"index":{"_id":"%s"}}%s`, util.GenerateRandomString(32), "\n"))
+		id := event.id
+		if id == "" {
+			id = util.GenerateRandomString(32)
+		}
+		meta := []byte(fmt.Sprintf(`{"index":{"_id":"%s"}}%s`, id, "\n"))
+		if event.index != "" {
+			meta = []byte(fmt.Sprintf(`{"index":{"_index":"%s","_id":"%s"}}%s`, event.index, id, "\n"))
+		}
 
 		doc, err := json.Marshal(event)
 		if err != nil {
@@ -2,13 +2,43 @@ package main
 
 import (
 	"encoding/json"
+	"time"
 )
 
 type Event struct {
-	Source *string                `json:"source,omitempty"`
-	Line   uint64                 `json:"line,omitempty"`
-	Offset int64                  `json:"offset,omitempty"`
-	Text   map[string]interface{} `json:"text,omitempty"`
+	Timestamp  time.Time              `json:"@timestamp"`
+	Source     *string                `json:"source,omitempty"`
+	Line       uint64                 `json:"line,omitempty"`
+	Offset     int64                  `json:"offset,omitempty"`
+	Text       map[string]interface{} `json:"text,omitempty"`
+	Truncated  bool                   `json:"truncated,omitempty"`
+	Meta       EventMeta              `json:"event"`
+	Stream     string                 `json:"stream,omitempty"`
+	Kubernetes *KubernetesMeta        `json:"kubernetes,omitempty"`
+	Host       *HostMeta              `json:"host,omitempty"`
+	Agent      *AgentMeta             `json:"agent,omitempty"`
+	Tags       []string               `json:"tags,omitempty"`
+
+	// RepeatCount is the number of identical events that were collapsed into this one, with the
+	// timestamps of the first and the last of them.
+	RepeatCount    int        `json:"repeat_count,omitempty"`
+	FirstTimestamp *time.Time `json:"first_timestamp,omitempty"`
+	LastTimestamp  *time.Time `json:"last_timestamp,omitempty"`
+
+	// Monitoring holds the metrics of the events that argo sends about itself.
+	Monitoring *MonitoringMeta `json:"monitoring,omitempty"`
+
+	id     string // Elasticsearch id of the document, or a random one if empty
+	size   int64  // raw bytes of the line in the file, including its newline
+	fields []byte // encoded members of the configured fields, shared by the events of an input
+	index  string // Elasticsearch index of the event, or the default one if empty
+	batch  uint64 // id of the batch, on its last event, which its ack carries back to the input
+}
+
+// EventMeta holds information about how the event was collected.
+type EventMeta struct {
+	// Ingested is the time the line was read.
+	Ingested time.Time `json:"ingested"`
 }
 
 func NewEvent(source *string, line uint64, offset int64, text *string) Event {
@@ -29,3 +59,21 @@ func (e *Event) GetLength() int64 {
 	jtext, _ := json.Marshal(e.Text)
 	return int64(len(string(jtext)))
 }
+
+// MarshalJSON encodes the event and appends its configured fields to the document.
+func (e Event) MarshalJSON() ([]byte, error) {
+	type event Event
+
+	doc, err := json.Marshal(event(e))
+	if err != nil || len(e.fields) == 0 {
+		return doc, err
+	}
+
+	res := make([]byte, 0, len(doc)+len(e.fields)+1)
+	res = append(res, doc[:len(doc)-1]...)
+	res = append(res, ',')
+	res = append(res, e.fields...)
+	res = append(res, '}')
+
+	return res, nil
+}
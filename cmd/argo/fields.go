@@ -0,0 +1,64 @@
+package main
+
+import "strings"
+
+// lookupField returns the value at the dotted path of nested objects in text. A key that contains
+// dots itself takes precedence over the nested objects.
+func lookupField(text map[string]interface{}, path string) (interface{}, bool) {
+	if v, ok := text[path]; ok {
+		return v, true
+	}
+
+	parts := strings.SplitN(path, ".", 2)
+	if len(parts) < 2 {
+		return nil, false
+	}
+
+	nested, ok := text[parts[0]].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return lookupField(nested, parts[1])
+}
+
+// putField sets the value at the dotted path of nested objects in text, creating the missing
+// objects and replacing any value that is in the way.
+func putField(text map[string]interface{}, path string, value interface{}) {
+	if _, ok := text[path]; ok {
+		text[path] = value
+		return
+	}
+
+	parts := strings.SplitN(path, ".", 2)
+	if len(parts) < 2 {
+		text[path] = value
+		return
+	}
+
+	nested, ok := text[parts[0]].(map[string]interface{})
+	if !ok {
+		nested = make(map[string]interface{})
+		text[parts[0]] = nested
+	}
+	putField(nested, parts[1], value)
+}
+
+// deleteField removes the value at the dotted path of nested objects in text and reports
+// whether it existed.
+func deleteField(text map[string]interface{}, path string) bool {
+	if _, ok := text[path]; ok {
+		delete(text, path)
+		return true
+	}
+
+	parts := strings.SplitN(path, ".", 2)
+	if len(parts) < 2 {
+		return false
+	}
+
+	nested, ok := text[parts[0]].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	return deleteField(nested, parts[1])
+}
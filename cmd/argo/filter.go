@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mresvanis/argo/pkg/expr"
+)
+
+// Filter keeps the events that match its include condition, if any, and do not match its
+// exclude condition. Conditions are expressions over the fields of the event text, e.g.
+// `level == "debug" && service != "payments"`.
+type Filter struct {
+	Include string `json:"include"`
+	Exclude string `json:"exclude"`
+
+	include *expr.Expr
+	exclude *expr.Expr
+}
+
+// OutputConfig holds the configuration of the output.
+type OutputConfig struct {
+	Filter
+
+	// Index is the Elasticsearch index of the events, instead of the default one.
+	Index string `json:"index"`
+}
+
+func (o *OutputConfig) parse() error {
+	if o.Index != "" && !validIndex(o.Index) {
+		return fmt.Errorf("invalid index %q", o.Index)
+	}
+	return o.Filter.parse()
+}
+
+func (f *Filter) parse() error {
+	var err error
+
+	if f.Include != "" {
+		f.include, err = expr.Parse(f.Include)
+		if err != nil {
+			return fmt.Errorf("invalid include condition; %s", err)
+		}
+	}
+
+	if f.Exclude != "" {
+		f.exclude, err = expr.Parse(f.Exclude)
+		if err != nil {
+			return fmt.Errorf("invalid exclude condition; %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Keep reports whether the event passes the filter.
+func (f *Filter) Keep(e *Event) bool {
+	lookup := textLookup(e)
+
+	if f.include != nil && !f.include.Match(lookup) {
+		return false
+	}
+	return f.exclude == nil || !f.exclude.Match(lookup)
+}
+
+// textLookup resolves the fields of conditions in the text of the event.
+func textLookup(e *Event) expr.Lookup {
+	return func(field string) (interface{}, bool) {
+		return lookupField(e.Text, field)
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mresvanis/argo/pkg/logging"
+	"github.com/mresvanis/argo/pkg/registry"
+	"github.com/mresvanis/argo/pkg/watch"
+)
+
+const (
+	pollInterval   = 1 * time.Second
+	rescanInterval = 10 * time.Second
+
+	// verifyInterval is how often an input that is reading checks whether its file was replaced
+	verifyInterval = 1 * time.Second
+)
+
+// Harvester starts an input for every file that matches the configured paths, which may be glob
+// patterns. Unless reading once, it rediscovers files when the directories of the paths change.
+type Harvester struct {
+	sync.Mutex
+
+	config  *Config
+	out     Output
+	reg     registry.Registrar
+	watcher watch.Watcher
+	log     *logging.Logger
+	term    chan struct{}
+	wg      sync.WaitGroup
+
+	inputs map[string]Input
+
+	// stats holds the merged stats of the terminated inputs of every path, until its file is
+	// removed.
+	stats map[string]InputStats
+
+	// restart holds the paths of the inputs that are started again once they terminate, as
+	// their settings changed on reload.
+	restart map[string]bool
+
+	// changes is notified when a watched directory changes or an input terminates, and watches
+	// holds the channel that stops watching each directory.
+	changes chan struct{}
+	watches map[string]chan struct{}
+}
+
+func NewHarvester(cfg *Config, out Output, reg registry.Registrar, watcher watch.Watcher) *Harvester {
+	h := new(Harvester)
+
+	h.config = cfg
+	h.out = out
+	h.reg = reg
+	h.watcher = watcher
+	h.log = cfg.logger("harvester")
+	h.term = make(chan struct{})
+	h.inputs = make(map[string]Input)
+	h.stats = make(map[string]InputStats)
+	h.restart = make(map[string]bool)
+	h.changes = make(chan struct{}, 1)
+	h.watches = make(map[string]chan struct{})
+
+	return h
+}
+
+// Start spawns the inputs for the files that currently match the configured paths and, unless
+// reading once, keeps rediscovering files until stopped.
+func (h *Harvester) Start() {
+	cfg := h.currentConfig()
+	if cfg.once {
+		h.scan(cfg.patterns(), true)
+		return
+	}
+
+	// watch the directories before the initial scan, so that no file created in between is missed
+	h.watchDirs()
+	h.scan(cfg.patterns(), true)
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.rediscover()
+	}()
+}
+
+// Reload applies the configuration to the harvested files: it stops the inputs of the files that
+// no longer match any path, restarts the rest if the settings of their input changed and starts
+// inputs for the files of the new paths. Restarted inputs read again from their last acked offset,
+// so the events they had not dispatched yet are not lost.
+func (h *Harvester) Reload(cfg *Config) {
+	h.Lock()
+	prev := h.config
+	h.config = cfg
+
+	for path, fi := range h.inputs {
+		if !cfg.matches(path) {
+			h.log.Info("stopping input of removed path", "path", path)
+			fi.Stop()
+		} else if inputSettings(prev.configOf(path)) != inputSettings(cfg.configOf(path)) {
+			h.log.Info("restarting input with the new settings", "path", path)
+			h.restart[path] = true
+			fi.Stop()
+		}
+	}
+	h.Unlock()
+
+	var added []string
+	for _, pattern := range cfg.patterns() {
+		if !contains(prev.patterns(), pattern) {
+			added = append(added, pattern)
+		}
+	}
+
+	if h.watcher != nil {
+		h.watchDirs()
+	}
+	h.scan(added, true)
+}
+
+// currentConfig returns the configuration of the harvester, which is replaced on reload.
+func (h *Harvester) currentConfig() *Config {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.config
+}
+
+// Stop terminates the rediscovery and every running input, once each has dispatched its pending
+// events and received their ack.
+func (h *Harvester) Stop() {
+	close(h.term)
+
+	h.Lock()
+	for _, fi := range h.inputs {
+		fi.Stop()
+	}
+	h.Unlock()
+}
+
+// Abort makes the running inputs give up on their batches in flight, so that a stop does not
+// wait for the output any longer.
+func (h *Harvester) Abort() {
+	h.Lock()
+	for _, fi := range h.inputs {
+		fi.Abort()
+	}
+	h.Unlock()
+}
+
+// Wait blocks until the rediscovery and every input have terminated.
+func (h *Harvester) Wait() {
+	h.wg.Wait()
+}
+
+// Stats returns the stats of every input started so far, sorted by path.
+func (h *Harvester) Stats() []InputStats {
+	h.Lock()
+	stats := make([]InputStats, 0, len(h.stats)+len(h.inputs))
+	for _, s := range h.stats {
+		stats = append(stats, s)
+	}
+	for _, fi := range h.inputs {
+		stats = append(stats, fi.Stats())
+	}
+	h.Unlock()
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Path < stats[j].Path
+	})
+	return stats
+}
+
+// Running returns the number of inputs that are harvesting their file.
+func (h *Harvester) Running() int {
+	h.Lock()
+	defer h.Unlock()
+
+	return len(h.inputs)
+}
+
+// Active returns the stats of the inputs that are harvesting their file, sorted by path.
+func (h *Harvester) Active() []InputStats {
+	h.Lock()
+	stats := make([]InputStats, 0, len(h.inputs))
+	for _, fi := range h.inputs {
+		stats = append(stats, fi.Stats())
+	}
+	h.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Path < stats[j].Path
+	})
+	return stats
+}
+
+// watchDirs watches the directories of the configured paths that are not watched yet, and stops
+// watching those of paths that are no longer configured. Changes notify h.changes.
+func (h *Harvester) watchDirs() {
+	dirs := h.dirs(h.currentConfig())
+
+	h.Lock()
+	defer h.Unlock()
+
+	for dir, stop := range h.watches {
+		if !contains(dirs, dir) {
+			close(stop)
+			delete(h.watches, dir)
+		}
+	}
+
+	for _, dir := range dirs {
+		if _, ok := h.watches[dir]; ok {
+			continue
+		}
+
+		ch, err := h.watcher.Watch(dir)
+		if err != nil {
+			h.log.Warn("could not watch directory", "dir", dir, "error", err)
+			continue
+		}
+
+		stop := make(chan struct{})
+		h.watches[dir] = stop
+
+		h.wg.Add(1)
+		go func(dir string, ch <-chan watch.Op) {
+			defer h.wg.Done()
+			defer h.watcher.Unwatch(dir)
+
+			for {
+				select {
+				case <-h.term:
+					return
+				case <-stop:
+					return
+				case <-ch:
+					select {
+					case h.changes <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}(dir, ch)
+	}
+}
+
+// rediscover rescans the configured paths whenever one of their directories changes, and
+// periodically in case a change notification was missed.
+func (h *Harvester) rediscover() {
+	ticker := time.NewTicker(rescanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.term:
+			return
+		case <-h.changes:
+		case <-ticker.C:
+		}
+
+		h.scan(h.currentConfig().patterns(), false)
+		h.pruneStats()
+	}
+}
+
+// pruneStats forgets the stats of the terminated inputs of the files that no longer exist, so that
+// they do not accumulate as files are rotated away.
+func (h *Harvester) pruneStats() {
+	h.Lock()
+	paths := make([]string, 0, len(h.stats))
+	for path := range h.stats {
+		if _, ok := h.inputs[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	h.Unlock()
+
+	for _, path := range paths {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			continue
+		}
+
+		h.Lock()
+		if _, ok := h.inputs[path]; !ok {
+			delete(h.stats, path)
+		}
+		h.Unlock()
+	}
+}
+
+// dirs returns the directories of the configured paths that do not contain glob patterns
+// themselves; the rest are only rediscovered periodically.
+func (h *Harvester) dirs(cfg *Config) []string {
+	patterns := cfg.patterns()
+
+	dirs := make([]string, 0, len(patterns))
+	for _, path := range patterns {
+		dir := filepath.Dir(path)
+		if !hasMeta(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return getUniquePaths(dirs)
+}
+
+// scan starts an input for every file matching the patterns that is not already harvested. Files
+// found while rediscovering are skipped if they have not been modified within the dead_time of
+// their input.
+func (h *Harvester) scan(patterns []string, initial bool) {
+	cfg := h.currentConfig()
+
+	for _, pattern := range getUniquePaths(patterns) {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			h.log.Error("invalid path", "path", pattern, "error", err)
+			continue
+		}
+		if len(matches) == 0 && initial && !hasMeta(pattern) {
+			// let the input report the missing file, like any other setup error
+			matches = []string{pattern}
+		}
+
+		for _, path := range matches {
+			if !initial {
+				info, err := os.Stat(path)
+				if err != nil || info.IsDir() || time.Since(info.ModTime()) >= cfg.configOf(path).deadtime {
+					continue
+				}
+			}
+
+			h.startInput(path, initial)
+		}
+	}
+}
+
+func (h *Harvester) startInput(path string, initial bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	select {
+	case <-h.term:
+		return
+	default:
+	}
+
+	if _, ok := h.inputs[path]; ok {
+		return
+	}
+
+	fi := NewFileInput(h.config.configOf(path), path, h.reg, h.watcher)
+	h.inputs[path] = fi
+
+	if !initial {
+		h.log.Info("discovered file", "path", path)
+	}
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		fi.Start(h.out.Input(), h.out.Subscribe(path))
+
+		stats := fi.Stats()
+		if stats.Dropped > 0 || stats.Filtered > 0 || stats.Sampled > 0 || stats.RateLimited > 0 {
+			h.log.Info("dropped events", "path", path, "processor", stats.Dropped, "condition", stats.Filtered,
+				"sampling", stats.Sampled, "rate_limit", stats.RateLimited)
+		}
+		if stats.Repeats > 0 {
+			h.log.Info("collapsed repeated events", "path", path, "repeats", stats.Repeats)
+		}
+
+		// unsubscribe while the input is still registered, so that a new input of the path
+		// cannot subscribe before
+		h.out.Unsubscribe(path)
+
+		h.Lock()
+		delete(h.inputs, path)
+		if prev, ok := h.stats[path]; ok {
+			mergeStats(&prev, stats)
+			stats = prev
+		}
+		h.stats[path] = stats
+		restart := h.restart[path] && h.config.matches(path)
+		delete(h.restart, path)
+		h.Unlock()
+
+		if restart {
+			h.startInput(path, true)
+			return
+		}
+
+		// the file may have been rotated away, so look for the one that took its path
+		select {
+		case h.changes <- struct{}{}:
+		default:
+		}
+	}()
+}
+
+// matchesAny reports whether path is one of the patterns or matches any of them.
+func matchesAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if pattern == path {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMeta(path string) bool {
+	for _, c := range path {
+		switch c {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+	return false
+}
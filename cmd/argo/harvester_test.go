@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testOutput is an Output that hands the received batches to the test, which acks them.
+type testOutput struct {
+	sync.Mutex
+
+	input       chan []Event
+	subscribers map[string]chan Ack
+}
+
+func newTestOutput() *testOutput {
+	return &testOutput{
+		input:       make(chan []Event),
+		subscribers: make(map[string]chan Ack),
+	}
+}
+
+func (o *testOutput) Input() chan<- []Event { return o.input }
+func (o *testOutput) Start()                {}
+func (o *testOutput) Stop()                 {}
+func (o *testOutput) Abort()                {}
+
+func (o *testOutput) Health() OutputHealth {
+	return OutputHealth{Running: true, Connected: true}
+}
+
+func (o *testOutput) Reload(*Config) error { return nil }
+
+func (o *testOutput) Subscribe(subID string) <-chan Ack {
+	o.Lock()
+	defer o.Unlock()
+
+	ch := make(chan Ack, 1)
+	o.subscribers[subID] = ch
+	return ch
+}
+
+func (o *testOutput) Unsubscribe(subID string) {
+	o.Lock()
+	delete(o.subscribers, subID)
+	o.Unlock()
+}
+
+func (o *testOutput) ack(events []Event) {
+	o.Lock()
+	defer o.Unlock()
+
+	last := events[len(events)-1]
+	o.subscribers[*last.Source] <- NewAck(last, false)
+}
+
+func TestHarvesterRediscover(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := *testcfg
+	cfg.Paths = []string{filepath.Join(dir, "*.log")}
+	cfg.dispatchInterval = 0
+
+	out := newTestOutput()
+	h := NewHarvester(&cfg, out, reg, testwatcher)
+	h.Start()
+
+	path := filepath.Join(dir, "new.log")
+	err = ioutil.WriteFile(path, []byte(`{"test":"field"}`+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case events := <-out.input:
+		assertEq(*events[0].Source, path, t)
+		assertEq(events[0].Text, map[string]interface{}{"test": "field"}, t)
+		out.ack(events)
+	case <-time.After(5 * time.Second):
+		t.Fatal("file was not discovered")
+	}
+
+	h.Stop()
+	h.Wait()
+
+	stats := h.Stats()
+	assertEq(len(stats), 1, t)
+	assertEq(statsWithoutTimes(stats[0]), InputStats{Path: path, Read: 1, Bytes: 17, Events: 1, Offset: 17, Size: 17}, t)
+}
+
+func TestHarvesterRotate(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(path, []byte(`{"old":1}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := *testcfg
+	cfg.Paths = []string{path}
+	cfg.dispatchInterval = 0
+
+	out := newTestOutput()
+	h := NewHarvester(&cfg, out, reg, testwatcher)
+	h.Start()
+	defer func() {
+		h.Stop()
+		h.Wait()
+	}()
+
+	events := receive(out, t)
+	assertEq(events[0].Text, map[string]interface{}{"old": 1.0}, t)
+	out.ack(events)
+
+	// the file is renamed right after a last write, and a new one is created at its path
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"old":2}` + "\n")
+	f.Close()
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(`{"new":"first line"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the old file is read to the end before the new one
+	events = receive(out, t)
+	assertEq(events[0].Text, map[string]interface{}{"old": 2.0}, t)
+	out.ack(events)
+
+	events = receive(out, t)
+	assertEq(events[0].Offset, int64(0), t)
+	assertEq(events[0].Text, map[string]interface{}{"new": "first line"}, t)
+	out.ack(events)
+}
+
+func TestHarvesterPruneStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	kept := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(kept, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	removed := filepath.Join(dir, "app.log.1")
+
+	h := NewHarvester(testcfg, nil, nil, nil)
+	h.stats = map[string]InputStats{
+		kept:    {Path: kept, Events: 2},
+		removed: {Path: removed, Events: 3},
+	}
+	h.pruneStats()
+
+	assertEq(h.Stats(), []InputStats{{Path: kept, Events: 2}}, t)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxAckAge    = "5m"
+	defaultInputTimeout = "5m"
+)
+
+// HealthConfig holds the thresholds after which the process is reported unhealthy or not ready.
+type HealthConfig struct {
+	// MaxAckAge is how long the output may go without a successful ack while events are waiting
+	// to be sent, before the process is unhealthy.
+	MaxAckAge string `json:"max_ack_age"`
+
+	// InputTimeout is how long an input may wait for the ack of its pending events, before the
+	// process is not ready.
+	InputTimeout string `json:"input_timeout"`
+
+	maxAckAge    time.Duration
+	inputTimeout time.Duration
+}
+
+func (hc *HealthConfig) parse() error {
+	var err error
+
+	if hc.MaxAckAge == "" {
+		hc.MaxAckAge = defaultMaxAckAge
+	}
+	hc.maxAckAge, err = time.ParseDuration(hc.MaxAckAge)
+	if err != nil || hc.maxAckAge <= 0 {
+		return fmt.Errorf("invalid health max_ack_age %q", hc.MaxAckAge)
+	}
+
+	if hc.InputTimeout == "" {
+		hc.InputTimeout = defaultInputTimeout
+	}
+	hc.inputTimeout, err = time.ParseDuration(hc.InputTimeout)
+	if err != nil || hc.inputTimeout <= 0 {
+		return fmt.Errorf("invalid health input_timeout %q", hc.InputTimeout)
+	}
+
+	return nil
+}
+
+// Check is the result of a health check.
+type Check struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// Health is the result of the health checks of the process.
+type Health struct {
+	OK     bool    `json:"ok"`
+	Checks []Check `json:"checks"`
+}
+
+// HealthChecker evaluates whether the output is connected and the inputs are progressing.
+type HealthChecker struct {
+	config  HealthConfig
+	out     Output
+	h       *Harvester
+	started time.Time
+	now     func() time.Time
+}
+
+func NewHealthChecker(cfg *Config, out Output, h *Harvester) *HealthChecker {
+	hc := new(HealthChecker)
+
+	hc.config = cfg.HTTP.Health
+	hc.out = out
+	hc.h = h
+	hc.now = time.Now
+	hc.started = hc.now()
+
+	return hc
+}
+
+// Live reports whether the process works at all: the output is running and, if events are
+// waiting, it has acked a batch within the ack timeout.
+func (hc *HealthChecker) Live() Health {
+	return newHealth(hc.outputRunning(), hc.outputAcking())
+}
+
+// Ready reports whether the process is live, the last request of the output succeeded and no
+// input has waited for an ack longer than the input timeout.
+func (hc *HealthChecker) Ready() Health {
+	return newHealth(hc.outputRunning(), hc.outputAcking(), hc.outputConnected(), hc.inputsProgressing())
+}
+
+func newHealth(checks ...Check) Health {
+	health := Health{OK: true, Checks: checks}
+	for _, c := range checks {
+		health.OK = health.OK && c.OK
+	}
+	return health
+}
+
+func (hc *HealthChecker) outputRunning() Check {
+	health := hc.out.Health()
+
+	c := Check{Name: "output_running", OK: health.Running}
+	if !c.OK {
+		c.Message = "output is not running"
+		if health.LastError != "" {
+			c.Message += "; " + health.LastError
+		}
+	}
+	return c
+}
+
+func (hc *HealthChecker) outputAcking() Check {
+	c := Check{Name: "output_acking", OK: true}
+
+	waiting := len(hc.out.Input()) > 0
+	for _, s := range hc.h.Active() {
+		waiting = waiting || s.Pending > 0
+	}
+	if !waiting {
+		return c
+	}
+
+	last := hc.out.Health().LastAck
+	if last.Before(hc.started) {
+		last = hc.started
+	}
+	if since := hc.now().Sub(last); since > hc.config.maxAckAge {
+		c.OK = false
+		c.Message = fmt.Sprintf("no successful ack for %s while events are waiting", since.Truncate(time.Second))
+	}
+	return c
+}
+
+func (hc *HealthChecker) outputConnected() Check {
+	health := hc.out.Health()
+
+	c := Check{Name: "output_connected", OK: health.Connected}
+	if !c.OK {
+		c.Message = "output is not connected"
+		if health.LastError != "" {
+			c.Message += "; " + health.LastError
+		}
+	}
+	return c
+}
+
+func (hc *HealthChecker) inputsProgressing() Check {
+	c := Check{Name: "inputs_progressing", OK: true}
+
+	var stalled []string
+	for _, s := range hc.h.Active() {
+		if s.Pending > 0 && hc.now().Sub(s.PendingSince) > hc.config.inputTimeout {
+			stalled = append(stalled, s.Path)
+		}
+	}
+	if len(stalled) > 0 {
+		c.OK = false
+		c.Message = fmt.Sprintf("waiting for acks longer than %s: %s", hc.config.inputTimeout, strings.Join(stalled, ", "))
+	}
+	return c
+}
+
+// healthHandler serves the result of the specified checks as JSON, with a 503 status if any of
+// them fails.
+func healthHandler(checks func() Health) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		health := checks()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !health.OK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(health)
+	})
+}
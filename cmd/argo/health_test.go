@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// healthOutput is an Output with the specified health.
+type healthOutput struct {
+	*testOutput
+
+	health OutputHealth
+}
+
+func (o *healthOutput) Health() OutputHealth { return o.health }
+
+// statsInput is an Input with the specified stats.
+type statsInput struct {
+	stats InputStats
+}
+
+func (i *statsInput) Start(chan<- []Event, <-chan Ack) {}
+func (i *statsInput) Stop()                            {}
+func (i *statsInput) Abort()                           {}
+func (i *statsInput) Stats() InputStats                { return i.stats }
+
+func TestHealthChecker(t *testing.T) {
+	now := time.Date(2019, 6, 9, 12, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		name   string
+		health OutputHealth
+		inputs []InputStats
+		live   bool
+		ready  bool
+		failed []string
+	}{
+		{
+			"idle",
+			OutputHealth{Running: true, Connected: true},
+			[]InputStats{{Path: "a.log"}},
+			true, true, nil,
+		}, {
+			"output setup failed",
+			OutputHealth{LastError: "failed to setup client"},
+			nil,
+			false, false, []string{"output_running", "output_connected"},
+		}, {
+			"output failing recently",
+			OutputHealth{Running: true, LastAck: now.Add(-time.Minute), LastError: "connection refused"},
+			[]InputStats{{Path: "a.log", Pending: 10, PendingSince: now.Add(-30 * time.Second)}},
+			true, false, []string{"output_connected"},
+		}, {
+			"output stale",
+			OutputHealth{Running: true, LastAck: now.Add(-10 * time.Minute), LastError: "connection refused"},
+			[]InputStats{{Path: "a.log", Pending: 10, PendingSince: now.Add(-10 * time.Minute)}, {Path: "b.log"}},
+			false, false, []string{"output_acking", "output_connected", "inputs_progressing"},
+		}, {
+			"input stalled",
+			OutputHealth{Running: true, Connected: true, LastAck: now.Add(-time.Second)},
+			[]InputStats{{Path: "a.log", Pending: 10, PendingSince: now.Add(-3 * time.Minute)}},
+			true, false, []string{"inputs_progressing"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := *testcfg
+			cfg.HTTP.Health = HealthConfig{MaxAckAge: "5m", InputTimeout: "2m"}
+			if err := cfg.HTTP.Health.parse(); err != nil {
+				t.Fatal(err)
+			}
+
+			out := &healthOutput{newTestOutput(), tt.health}
+			h := NewHarvester(&cfg, out, nil, nil)
+			for _, s := range tt.inputs {
+				h.inputs[s.Path] = &statsInput{s}
+			}
+
+			hc := NewHealthChecker(&cfg, out, h)
+			hc.started = now.Add(-time.Hour)
+			hc.now = func() time.Time { return now }
+
+			assertEq(hc.Live().OK, tt.live, t)
+
+			ready := hc.Ready()
+			assertEq(ready.OK, tt.ready, t)
+
+			var failed []string
+			for _, c := range ready.Checks {
+				if !c.OK {
+					failed = append(failed, c.Name)
+				}
+			}
+			assertEq(failed, tt.failed, t)
+		})
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	for _, ok := range []bool{true, false} {
+		health := Health{OK: ok, Checks: []Check{{Name: "output_running", OK: ok}}}
+
+		rec := httptest.NewRecorder()
+		healthHandler(func() Health { return health }).ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+
+		status := 200
+		if !ok {
+			status = 503
+		}
+		assertEq(rec.Code, status, t)
+
+		var res Health
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		assertEq(res, health, t)
+	}
+}
@@ -1,21 +1,32 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/xerrors"
 
+	"github.com/mresvanis/argo/pkg/logging"
 	"github.com/mresvanis/argo/pkg/registry"
 	"github.com/mresvanis/argo/pkg/util"
+	"github.com/mresvanis/argo/pkg/watch"
 )
 
-const (
-	batchSize = 128
+var (
+	errHarvested = xerrors.New("file already harvested to completion")
+	errAborted   = xerrors.New("input aborted")
+
+	// lastBatch is the id of the last batch dispatched by any input, so that every ack can be
+	// correlated with its batch.
+	lastBatch uint64
 )
 
 // Input starts watching the specified file.
@@ -23,114 +34,592 @@ type Input interface {
 	// Start spawns a read loop and outputs batches of Events while waiting for acks.
 	Start(chan<- []Event, <-chan Ack)
 
-	// Stop terminates the read loop.
+	// Stop terminates the read loop, once the events read so far are dispatched and acked.
 	Stop()
+
+	// Abort gives up on the batch being dispatched, whose events are read again on the next
+	// start, so that a stopped input terminates even if the output is stuck.
+	Abort()
+
+	// Stats returns the work done by the input so far.
+	Stats() InputStats
+}
+
+// InputStats summarises the work done by an input.
+type InputStats struct {
+	Path        string
+	Inode       uint64
+	Read        uint64        // lines read
+	Bytes       uint64        // bytes read
+	Events      uint64        // events acknowledged by the output
+	Failed      uint64        // events of failed batches, which are retried
+	Errors      uint64        // failed batches, setup and read errors
+	Resets      uint64        // times the file was truncated or its content replaced
+	Resent      uint64        // batches sent again as their ack timed out
+	Long        uint64        // lines longer than max_line_bytes, truncated or skipped
+	Dropped     uint64        // events dropped by processors
+	Filtered    uint64        // events excluded by the include and exclude conditions
+	Sampled     uint64        // events dropped by sampling
+	RateLimited uint64        // events dropped over the rate limit
+	Repeats     uint64        // events collapsed into an identical one by dedup
+	Throttled   time.Duration // time reading paused by the rate limit
+	Offset      int64         // offset acknowledged in the registry
+	Size        int64         // size of the file when last checked
+
+	// Pending is the number of events read but not acked yet, and PendingSince when the oldest
+	// of them was read.
+	Pending      int
+	PendingSince time.Time
+
+	LastRead  time.Time // time the last line was read
+	LastAck   time.Time // time the last batch was acked
+	LastError string    // last setup, read or dispatch error
 }
 
 type FileInput struct {
-	config *Config
-	reg    registry.Registrar
+	config  *Config
+	reg     registry.Registrar
+	watcher watch.Watcher
 
 	path   string
 	offset int64
+	line   uint64
+	key    string
+
+	file         *os.File
+	compression  util.Compression
+	decompressor io.ReadCloser
+	state        util.FileState
+	fingerprint  util.Fingerprint
+	origin       string // hash of the first line of the file, part of the document ids
 
-	file *os.File
-	log  *log.Logger
-	term chan struct{}
+	log       *logging.Logger
+	term      chan struct{}
+	stopOnce  sync.Once
+	abort     chan struct{}
+	abortOnce sync.Once
+	changes   <-chan watch.Op
+	moved     bool // the watcher reported that the file was renamed or removed
+	once      bool
 
-	events []Event
+	events     []Event
+	processors Processors
+	tags       []string
+	fields     []byte
+	container  *containerReader
+	multiline  *multiline
+	limiter    *limiter
+	sampler    *sampler
+	dedup      *deduper
+	kube       *KubernetesMeta
+	podErr     error
+	stats      InputStats
+	statsLock  sync.Mutex
 
-	reader       *bufio.Reader
-	buffer       *bytes.Buffer
+	lines        *util.LineReader
 	lastSendTime time.Time
 	lastReadTime time.Time
-	readTimeout  time.Duration
+	lastVerified time.Time
+	waitTimeout  time.Duration
 }
 
-func NewFileInput(cfg *Config, path string, reg registry.Registrar) Input {
+func NewFileInput(cfg *Config, path string, reg registry.Registrar, watcher watch.Watcher) Input {
 	fi := new(FileInput)
 
 	fi.config = cfg
 	fi.path = path
+	fi.key = path
 	fi.reg = reg
+	fi.watcher = watcher
+	fi.stats.Path = path
 
-	fi.log = log.New(os.Stderr, "[file] ", log.LstdFlags)
+	fi.log = cfg.logger("file").With("path", path)
 	fi.term = make(chan struct{})
+	fi.abort = make(chan struct{})
+
+	// every input gets its own chain; the configuration has already been validated
+	processors, err := NewProcessors(cfg.Processors)
+	if err != nil {
+		fi.log.Error("invalid processors", "error", err)
+	}
+	fi.processors = processors
+
+	fi.tags, fi.fields, err = cfg.metaOf()
+	if err != nil {
+		fi.log.Error("invalid tags or fields", "error", err)
+	}
+
+	fi.limiter = newLimiter(cfg.RateLimit)
+	fi.sampler = newSampler(cfg.Sampling)
+	fi.dedup = newDeduper(cfg.Dedup)
+
+	if cfg.Format != formatJSON {
+		fi.container = newContainerReader(cfg.Format, cfg.MaxLineBytes)
+		fi.kube, _ = parsePodPath(path)
+	} else {
+		fi.multiline = newMultiline(cfg.Multiline, cfg.MaxLineBytes)
+	}
 
 	return fi
 }
 
 func (fi *FileInput) Start(output chan<- []Event, ack <-chan Ack) {
-	var line uint64 = 0
-
 	err := fi.setup()
 	if err != nil {
-		fi.log.Printf("%s; %s", fi.path, err.Error())
+		if xerrors.Is(err, errHarvested) {
+			fi.log.Info("already harvested")
+		} else {
+			fi.log.Error("could not set up input", "error", err)
+			fi.updateStats(func(s *InputStats) {
+				s.Errors++
+				s.LastError = err.Error()
+			})
+		}
 		return
 	}
-	defer fi.file.Close()
+	defer fi.close()
+
+	// the events left pending when the input terminates are read again on its next start
+	defer fi.updateStats(func(s *InputStats) {
+		s.Pending = 0
+		s.PendingSince = time.Time{}
+	})
 
 	for {
+		if fi.multiline != nil {
+			if g, ok := fi.multiline.expired(time.Now()); ok {
+				fi.appendEvent(&g.text, g.bytes, g.lines, g.truncated)
+			}
+		}
+		if fi.dedup != nil {
+			fi.pend(fi.dedup.expired(time.Now())...)
+		}
 		if len(fi.events) > 0 && fi.shouldDispatch() {
-			fi.dispatch(output, ack)
+			err := fi.dispatch(output, ack)
+			if err != nil && fi.config.once {
+				break
+			}
 		}
 		if fi.stopped() {
 			break
 		}
 
-		text, bytesread, err := util.Readline(fi.reader, fi.buffer, fi.readTimeout)
+		// a file may also be replaced while a backlog is read
+		if fi.compression == util.CompressionNone && time.Since(fi.lastVerified) >= verifyInterval {
+			fi.checkReplaced(output, ack)
+		}
+
+		text, bytesread, truncated, err := fi.lines.Readline()
 		if xerrors.Is(err, io.EOF) {
+			if fi.once {
+				if text, bytesread, truncated := fi.lines.Flush(); text != nil {
+					fi.appendLine(text, bytesread, truncated)
+				}
+				if fi.multiline != nil {
+					if g, ok := fi.multiline.flush(); ok {
+						fi.appendEvent(&g.text, g.bytes, g.lines, g.truncated)
+					}
+				}
+				if fi.container != nil {
+					// the file ended in the middle of a split message, so send what was read
+					if e, ok, _ := fi.container.flush(); ok {
+						e.id = fi.documentID(e.Offset)
+						fi.publish(e)
+					}
+				}
+				if fi.dedup != nil {
+					fi.pend(fi.dedup.flush()...)
+				}
+
+				if fi.finish(output, ack) {
+					break
+				}
+				continue
+			}
+
 			if fi.isFileDead() {
-				fi.log.Printf("stopped watching dead file %s", fi.path)
+				fi.log.Info("stopped watching dead file")
 				break
 			}
 
-			if util.IsFileTruncated(fi.file, fi.offset) {
-				fi.log.Printf("file %s truncated, seeking from start", fi.path)
-				fi.resetFileOffset()
-				line = 0
+			fi.wait()
+
+			// a file rotated away is read to the end, and its input terminates so that the
+			// file that takes its path is harvested by a new one
+			if fi.movedAway() {
+				fi.log.Info("file moved away, reading it to the end")
+				fi.once = true
+				continue
 			}
 
+			// check before reading further, as a replaced file may have already grown past
+			// the current offset
+			fi.checkReplaced(output, ack)
 			continue
 		}
 		if err != nil {
-			fi.log.Printf("unexpected state reading from %s, %s", fi.path, err)
+			fi.log.Error("unexpected state reading file", "error", err)
+			fi.updateStats(func(s *InputStats) {
+				s.Errors++
+				s.LastError = err.Error()
+			})
 			break
 		}
 
 		fi.lastReadTime = time.Now()
-		line++
-		fi.events = append(fi.events, NewEvent(&fi.path, line, fi.offset, text))
-		fi.offset += int64(bytesread)
+		fi.appendLine(text, bytesread, truncated)
+
+		if int64(len(fi.events)) >= fi.config.BatchSize || fi.shouldDispatch() {
+			err := fi.dispatch(output, ack)
+			if err != nil && fi.config.once {
+				break
+			}
+		}
+	}
+
+	if fi.stopped() && len(fi.events) > 0 {
+		// the partial lines and groups are not complete events yet, and are read again on the
+		// next start along with the events held by dedup
+		fi.log.Info("dispatching pending events", "events", len(fi.events))
+		fi.dispatch(output, ack)
+	}
+
+	fi.log.Info("terminated input")
+}
+
+// appendLine adds the line read at the current offset to the pending events or, with multiline,
+// to the current group of lines, adding the groups it completes instead.
+func (fi *FileInput) appendLine(text *string, bytesread int, truncated bool) {
+	if fi.multiline == nil {
+		fi.appendEvent(text, bytesread, 1, truncated)
+		return
+	}
+
+	for _, g := range fi.multiline.add(*text, bytesread, truncated, fi.lastReadTime) {
+		fi.appendEvent(&g.text, g.bytes, g.lines, g.truncated)
+	}
+}
+
+// appendEvent adds the lines read at the current offset to the pending events as one event and
+// advances the offset past them. Lines longer than max_line_bytes are either truncated or
+// skipped.
+func (fi *FileInput) appendEvent(text *string, bytesread int, lines uint64, truncated bool) {
+	offset := fi.offset
+
+	fi.line += lines
+	fi.offset += int64(bytesread)
+	fi.updateStats(func(s *InputStats) {
+		s.Read += lines
+		s.Bytes += uint64(bytesread)
+		s.LastRead = fi.lastReadTime
+	})
+
+	if truncated {
+		fi.updateStats(func(s *InputStats) { s.Long++ })
+
+		if fi.config.LongLines == longLinesSkip {
+			fi.log.Warn("skipped long line", "line", fi.line, "bytes", bytesread, "offset", offset)
+			return
+		}
+	}
+
+	var e Event
+	if fi.container != nil {
+		var ok bool
+		var err error
+
+		e, ok, err = fi.container.add(&fi.path, fi.line, offset, bytesread, *text)
+		if err != nil {
+			fi.log.Warn("invalid container line", "line", fi.line, "error", err)
+		}
+		if !ok {
+			return
+		}
+	} else {
+		e = NewEvent(&fi.path, fi.line-lines+1, offset, text)
+		e.size = int64(bytesread)
+	}
+	e.id = fi.documentID(e.Offset)
+
+	if truncated {
+		e.Truncated = true
+	}
+	if e.Text == nil && (truncated || lines > 1) {
+		// a truncated JSON line does not parse, and the lines of a stack trace are not JSON,
+		// so keep what was read as text
+		e.Text = map[string]interface{}{"message": *text}
+	}
+
+	fi.publish(e)
+}
+
+// documentID returns the Elasticsearch id of the event at the specified offset, which is derived
+// from the identity of the file, its first line and the offset, so that a batch that is sent
+// again, or read again after a restart, overwrites the documents it already indexed instead of
+// duplicating them. The first line is complete once an event is read and does not change as the
+// file grows, while it tells apart the content written after the file was truncated.
+func (fi *FileInput) documentID(offset int64) string {
+	if fi.origin == "" {
+		head := make([]byte, fi.config.FingerprintSize)
+		n, _ := fi.file.ReadAt(head, 0)
+		if i := bytes.IndexByte(head[:n], '\n'); i >= 0 {
+			n = i + 1
+		}
+		sum := sha256.Sum256(head[:n])
+		fi.origin = hex.EncodeToString(sum[:])
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d", fi.state.Key(), fi.origin, offset)
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// publish filters, processes and enriches an event and adds it to the pending events, unless
+// dedup holds it until its window ends.
+func (fi *FileInput) publish(e Event) {
+	e.Meta.Ingested = time.Now().UTC()
+
+	// container runtimes record the time the line was written
+	fallback := e.Meta.Ingested
+	if !e.Timestamp.IsZero() {
+		fallback = e.Timestamp
+	}
+	e.Timestamp = fi.config.Timestamp.extract(e.Text, fallback)
+
+	if !fi.config.Filter.Keep(&e) {
+		fi.updateStats(func(s *InputStats) { s.Filtered++ })
+		return
+	}
+
+	if fi.sampler != nil && !fi.sampler.keep(&e) {
+		fi.updateStats(func(s *InputStats) { s.Sampled++ })
+		return
+	}
+
+	if fi.limiter != nil {
+		if fi.limiter.mode == rateLimitDrop {
+			if !fi.limiter.allow(e.size) {
+				fi.updateStats(func(s *InputStats) { s.RateLimited++ })
+				return
+			}
+		} else {
+			fi.throttle(fi.limiter.wait(e.size))
+		}
+	}
+
+	if len(fi.processors) > 0 {
+		keep, err := fi.processors.Process(&e)
+		if err != nil {
+			fi.log.Warn("processor failed", "line", e.Line, "error", err)
+		}
+		if !keep {
+			fi.updateStats(func(s *InputStats) { s.Dropped++ })
+			return
+		}
+	}
+
+	if !fi.config.Output.Keep(&e) {
+		fi.updateStats(func(s *InputStats) { s.Filtered++ })
+		return
+	}
+
+	e.index = fi.config.Output.Index
+	e.Host = fi.config.host
+	e.Agent = fi.config.agent
+	e.Tags = fi.tags
+	e.fields = fi.fields
+	if fi.kube != nil {
+		e.Kubernetes = fi.kubernetesMeta()
+	}
+
+	if fi.dedup != nil {
+		if held, repeat := fi.dedup.add(e, time.Now()); held {
+			if repeat {
+				fi.updateStats(func(s *InputStats) { s.Repeats++ })
+			}
+			return
+		}
+	}
+
+	fi.pend(e)
+}
+
+// pend adds events to the pending events, recording since when events are pending.
+func (fi *FileInput) pend(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	fi.events = append(fi.events, events...)
+
+	n := len(fi.events)
+	fi.updateStats(func(s *InputStats) {
+		if s.Pending == 0 {
+			s.PendingSince = time.Now()
+		}
+		s.Pending = n
+	})
+}
+
+// throttle pauses reading for the specified duration, unless the input is stopped.
+func (fi *FileInput) throttle(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	fi.updateStats(func(s *InputStats) { s.Throttled += d })
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-fi.term:
+	case <-timer.C:
+	}
+}
+
+// kubernetesMeta returns the metadata of the container that writes the file, including the pod
+// labels if a metadata provider is configured.
+func (fi *FileInput) kubernetesMeta() *KubernetesMeta {
+	if fi.config.pods == nil {
+		return fi.kube
+	}
 
-		if len(fi.events) >= batchSize || fi.shouldDispatch() {
-			fi.dispatch(output, ack)
+	pod, err := fi.config.pods.PodMetadata(fi.kube.Namespace, fi.kube.Pod.Name)
+	if err != nil {
+		// failures are cached, so log each one once
+		if err != fi.podErr {
+			fi.log.Warn("could not get pod metadata", "error", err)
+			fi.podErr = err
 		}
+		return fi.kube
 	}
 
-	fi.log.Printf("terminated input for %s", fi.path)
+	k := *fi.kube
+	k.Pod.UID = pod.UID
+	k.Labels = pod.Labels
+	return &k
 }
 
 func (fi *FileInput) Stop() {
-	fi.log.Printf("terminating input for %s", fi.path)
-	fi.term <- struct{}{}
+	fi.stopOnce.Do(func() {
+		fi.log.Info("terminating input")
+		close(fi.term)
+	})
+}
+
+func (fi *FileInput) Abort() {
+	fi.abortOnce.Do(func() {
+		close(fi.abort)
+	})
 }
 
-func (fi *FileInput) dispatch(output chan<- []Event, ack <-chan Ack) {
-	output <- fi.events
+func (fi *FileInput) Stats() InputStats {
+	fi.statsLock.Lock()
+	defer fi.statsLock.Unlock()
+
+	return fi.stats
+}
 
-	err := fi.waitForAck(ack)
-	if xerrors.Is(err, registry.ErrUpdate) {
-		fi.log.Printf("%s; %s", fi.path, err.Error())
+func (fi *FileInput) updateStats(update func(*InputStats)) {
+	fi.statsLock.Lock()
+	update(&fi.stats)
+	fi.statsLock.Unlock()
+}
+
+// updateSize records the current size of the file, so that the lag behind it is known.
+func (fi *FileInput) updateSize() {
+	info, err := fi.file.Stat()
+	if err != nil {
+		return
+	}
+	fi.updateStats(func(s *InputStats) { s.Size = info.Size() })
+}
+
+// dispatch sends the pending events to the output and waits for their ack, sending them again
+// whenever the ack times out. The events are kept for a later retry if the batch fails, and the
+// error is returned.
+func (fi *FileInput) dispatch(output chan<- []Event, ack <-chan Ack) error {
+	n := uint64(len(fi.events))
+	fi.updateSize()
+
+	if fi.aborted() {
+		return errAborted
+	}
+
+	// the output may still hold a batch that timed out, so the id is set on a copy of the events
+	batch := make([]Event, len(fi.events))
+	copy(batch, fi.events)
+	id := atomic.AddUint64(&lastBatch, 1)
+	batch[len(batch)-1].batch = id
+
+	start := time.Now()
+	err := fi.waitForAck(output, ack, batch, id)
+	fi.config.metrics.observeAck(time.Since(start))
+	if xerrors.Is(err, errAborted) {
+		fi.log.Warn("abandoned batch", "events", n)
+		return err
+	} else if xerrors.Is(err, registry.ErrUpdate) {
+		fi.log.Error("could not update registry", "error", err)
+		fi.updateStats(func(s *InputStats) { s.LastError = err.Error() })
 
 	} else if err != nil {
-		fi.log.Printf("%s; %s", fi.path, err.Error())
+		fi.log.Error("batch failed", "events", n, "error", err)
+		fi.updateStats(func(s *InputStats) {
+			s.Errors++
+			s.Failed += n
+			s.LastError = err.Error()
+		})
 		fi.lastSendTime = time.Now()
-		return
+		return err
 	}
 
+	fi.updateStats(func(s *InputStats) {
+		s.Events += n
+		s.Pending = 0
+		s.PendingSince = time.Time{}
+	})
 	fi.events = []Event{}
 	fi.lastSendTime = time.Now()
+
+	return nil
+}
+
+// finish dispatches the remaining events of a file that has been read to EOF and, for compressed
+// files, marks it complete in the registry. It returns false if the input should keep retrying
+// the final batch.
+func (fi *FileInput) finish(output chan<- []Event, ack <-chan Ack) bool {
+	if len(fi.events) > 0 {
+		err := fi.dispatch(output, ack)
+		if err != nil {
+			if fi.config.once {
+				return true
+			}
+
+			time.Sleep(1 * time.Second)
+			return false
+		}
+	}
+
+	if fi.compression != util.CompressionNone {
+		err := fi.reg.MarkComplete(fi.key)
+		if err != nil {
+			fi.log.Error("could not mark file complete", "error", err)
+			return false
+		}
+	}
+
+	fi.log.Info("harvested to completion")
+	return true
+}
+
+func (fi *FileInput) close() {
+	if fi.changes != nil {
+		fi.watcher.Unwatch(fi.path)
+	}
+	if fi.decompressor != nil {
+		fi.decompressor.Close()
+	}
+	fi.file.Close()
 }
 
 func (fi *FileInput) isFileDead() bool {
@@ -139,20 +628,140 @@ func (fi *FileInput) isFileDead() bool {
 
 func (fi *FileInput) resetFileOffset() {
 	fi.file.Seek(0, os.SEEK_SET)
+	fi.lines.Reset(fi.file)
+	fi.lines.DetectBOM()
+	if fi.container != nil {
+		fi.container.reset()
+	}
+	if fi.multiline != nil {
+		fi.multiline.reset()
+	}
 	fi.offset = 0
+	fi.line = 0
+
+	err := fi.reg.UpdateOffset(fi.key, 0)
+	if err != nil {
+		fi.log.Error("could not update registry", "error", err)
+	}
+	fi.updateStats(func(s *InputStats) { s.Offset = 0 })
+
+	fi.fingerprint = util.Fingerprint{}
+	fi.origin = ""
+	fi.verifyFingerprint()
+}
+
+// checkReplaced starts reading the file from the start if its content is no longer the one read
+// so far, once the pending events, which refer to the previous content, are dispatched.
+func (fi *FileInput) checkReplaced(output chan<- []Event, ack <-chan Ack) {
+	fi.lastVerified = time.Now()
+
+	reason := fi.replaced()
+	if reason == "" {
+		return
+	}
+	fi.log.Warn("file changed, seeking from start", "reason", reason)
+	fi.updateStats(func(s *InputStats) { s.Resets++ })
+
+	if fi.multiline != nil {
+		if g, ok := fi.multiline.flush(); ok {
+			fi.appendEvent(&g.text, g.bytes, g.lines, g.truncated)
+		}
+	}
+	if fi.dedup != nil {
+		fi.pend(fi.dedup.flush()...)
+	}
+	if len(fi.events) > 0 {
+		fi.dispatch(output, ack)
+	}
+
+	fi.resetFileOffset()
+}
+
+// replaced returns why the file content is no longer the one read so far, or an empty string if
+// it is unchanged.
+func (fi *FileInput) replaced() string {
+	if util.IsFileTruncated(fi.file, fi.offset) {
+		return "truncated"
+	}
+	if !fi.verifyFingerprint() {
+		return "content replaced"
+	}
+	return ""
+}
+
+// verifyFingerprint compares the fingerprint of the current file content with the known one,
+// and returns false if they differ. The fingerprint is extended and stored as the file grows,
+// until it covers fingerprint_size bytes.
+func (fi *FileInput) verifyFingerprint() bool {
+	info, err := fi.file.Stat()
+	if err != nil {
+		return true
+	}
+
+	if !fi.fingerprint.IsZero() {
+		if info.Size() < fi.fingerprint.Size {
+			return false
+		}
+
+		fp, err := util.NewFingerprint(fi.file, fi.fingerprint.Size)
+		if err != nil {
+			fi.log.Warn("could not fingerprint file", "error", err)
+			return true
+		}
+		if fp.Hash != fi.fingerprint.Hash {
+			return false
+		}
+	}
+
+	size := info.Size()
+	if size > fi.config.FingerprintSize {
+		size = fi.config.FingerprintSize
+	}
+	if size <= fi.fingerprint.Size {
+		return true
+	}
+
+	fp, err := util.NewFingerprint(fi.file, size)
+	if err != nil {
+		fi.log.Warn("could not fingerprint file", "error", err)
+		return true
+	}
+	fi.fingerprint = fp
+
+	err = fi.reg.UpdateFingerprint(fi.key, fp.String())
+	if err != nil {
+		fi.log.Error("could not update registry", "error", err)
+	}
+	return true
 }
 
 func (fi *FileInput) setFileOffset() {
 	offset, _ := fi.file.Seek(0, os.SEEK_CUR)
-	fi.offset, _ = fi.reg.GetOffset(fi.path)
+	fi.offset, _ = fi.reg.GetOffset(fi.key)
+
+	stored, _ := fi.reg.GetFingerprint(fi.key)
+	if stored != "" {
+		fi.fingerprint, _ = util.ParseFingerprint(stored)
+	}
+
+	if !fi.verifyFingerprint() {
+		fi.log.Warn("file changed since last read, seeking from start", "reason", "content replaced")
+		fi.updateStats(func(s *InputStats) { s.Resets++ })
+
+		fi.fingerprint = util.Fingerprint{}
+		fi.verifyFingerprint()
+		fi.offset = 0
+	}
+
+	fi.updateStats(func(s *InputStats) { s.Offset = fi.offset })
 
 	if fi.offset > 0 {
-		fi.log.Printf("%s position:%d (offset snapshot:%d)", fi.path, fi.offset, offset)
+		fi.log.Info("resuming", "offset", fi.offset, "snapshot", offset)
 		fi.file.Seek(fi.offset, os.SEEK_SET)
 		return
 	}
 
-	fi.log.Printf("%s (offset snapshot:%d)", fi.path, offset)
+	fi.log.Info("reading from start", "snapshot", offset)
 	fi.file.Seek(0, os.SEEK_SET)
 	fi.offset = 0
 }
@@ -164,18 +773,101 @@ func (fi *FileInput) setup() error {
 	}
 	fi.file = file
 
-	fi.setFileOffset()
-
-	_, err = fi.file.Stat()
+	info, err := fi.file.Stat()
 	if err != nil {
+		fi.file.Close()
 		return xerrors.Errorf("cound not stat file: %w", err)
 	}
+	fi.state = util.NewFileState(&fi.path, 0, info)
+	fi.updateStats(func(s *InputStats) { s.Inode = fi.state.Inode })
+
+	fi.compression = util.CompressionOf(fi.path)
+	if fi.compression != util.CompressionNone {
+		err = fi.setupCompressed(info)
+		if err != nil {
+			fi.close()
+			return err
+		}
+	} else {
+		fi.setFileOffset()
+
+		enc := fi.config.encoding()
+		if fi.offset > 0 {
+			head := make([]byte, 4)
+			n, _ := fi.file.ReadAt(head, 0)
+			enc = enc.WithBOM(head[:n])
+		}
+
+		fi.lines = util.NewLineReader(fi.file, int(fi.config.MaxLineBytes), enc)
+		if fi.offset == 0 {
+			fi.lines.DetectBOM()
+		}
+		fi.waitTimeout = 10 * time.Second
+		fi.once = fi.config.once
+	}
+
+	if !fi.once {
+		fi.changes, err = fi.watcher.Watch(fi.path)
+		if err != nil {
+			fi.close()
+			return xerrors.Errorf("could not watch file: %w", err)
+		}
+	}
 
-	fi.reader = bufio.NewReaderSize(fi.file, 16<<10) // 16kb buffer by default
-	fi.buffer = new(bytes.Buffer)
 	fi.lastReadTime = time.Now()
 	fi.lastSendTime = fi.lastReadTime
-	fi.readTimeout = 10 * time.Second
+
+	return nil
+}
+
+// setupCompressed prepares a compressed file to be read once to completion. Since compressed
+// files cannot be seeked, their registry state is keyed by the file identity and the fingerprint
+// of its content instead of the path, so that they are not read again when rotated to another
+// name, while a new file that reuses the inode of a deleted one is.
+func (fi *FileInput) setupCompressed(info os.FileInfo) error {
+	if !fi.config.ReadCompressed {
+		return xerrors.Errorf("%s file skipped, read_compressed is disabled", fi.compression)
+	}
+
+	size := fi.config.FingerprintSize
+	if info.Size() < size {
+		size = info.Size()
+	}
+	fp, err := util.NewFingerprint(fi.file, size)
+	if err != nil {
+		return err
+	}
+
+	fi.key = fi.state.Key() + ":" + fp.String()
+
+	complete, err := fi.reg.IsComplete(fi.key)
+	if err != nil {
+		return err
+	}
+	if complete {
+		return xerrors.Errorf("%s %w", fi.compression, errHarvested)
+	}
+
+	fi.decompressor, err = util.NewDecompressor(fi.file, fi.compression)
+	if err != nil {
+		return err
+	}
+
+	fi.offset, _ = fi.reg.GetOffset(fi.key)
+	if fi.offset > 0 {
+		fi.log.Info("resuming", "offset", fi.offset, "decompressed", true)
+
+		_, err = io.CopyN(ioutil.Discard, fi.decompressor, fi.offset)
+		if err != nil {
+			return xerrors.Errorf("could not skip to offset %d: %w", fi.offset, err)
+		}
+	}
+
+	fi.lines = util.NewLineReader(fi.decompressor, int(fi.config.MaxLineBytes), fi.config.encoding())
+	if fi.offset == 0 {
+		fi.lines.DetectBOM()
+	}
+	fi.once = true
 
 	return nil
 }
@@ -184,6 +876,66 @@ func (fi *FileInput) shouldDispatch() bool {
 	return time.Now().Sub(fi.lastSendTime) >= fi.config.dispatchInterval
 }
 
+// wait blocks until the file changes, the input is stopped or the pending events are due for
+// dispatch. It also returns after waitTimeout, so that dead files are eventually detected.
+func (fi *FileInput) wait() {
+	fi.updateSize()
+
+	timeout := fi.waitTimeout
+	if len(fi.events) > 0 {
+		if due := fi.config.dispatchInterval - time.Since(fi.lastSendTime); due < timeout {
+			timeout = due
+		}
+	}
+	if fi.dedup != nil {
+		if next, ok := fi.dedup.next(); ok {
+			if due := time.Until(next); due < timeout {
+				timeout = due
+			}
+		}
+	}
+	if fi.multiline != nil {
+		if deadline, ok := fi.multiline.deadline(); ok {
+			if due := time.Until(deadline); due < timeout {
+				timeout = due
+			}
+		}
+	}
+	if timeout <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case op := <-fi.changes:
+		if op&(watch.Rename|watch.Remove) != 0 {
+			fi.moved = true
+		}
+	case <-fi.term:
+	case <-timer.C:
+	}
+}
+
+// movedAway reports whether the file was renamed or removed, or its path now refers to another
+// file, as notifications may be coalesced or missed.
+func (fi *FileInput) movedAway() bool {
+	if fi.moved {
+		return true
+	}
+
+	cur, err := os.Stat(fi.path)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	info, err := fi.file.Stat()
+	if err != nil {
+		return false
+	}
+	return !os.SameFile(cur, info)
+}
+
 func (fi *FileInput) stopped() bool {
 	select {
 	case <-fi.term:
@@ -193,25 +945,105 @@ func (fi *FileInput) stopped() bool {
 	return false
 }
 
-func (fi *FileInput) waitForAck(ackCh <-chan Ack) error {
+func (fi *FileInput) aborted() bool {
 	select {
-	case ack, ok := <-ackCh:
-		// TODO: ERROR HANDLING
-		if !ok {
-			return xerrors.Errorf("ack channel error")
+	case <-fi.abort:
+		return true
+	default:
+	}
+	return false
+}
+
+// waitForAck sends the batch with the specified id to the output and blocks until its ack is
+// received, sending it again whenever the ack times out, and updates the registry with the offset
+// of its events. Acks of other batches, such as a late one of a batch that was resent, are logged
+// and skipped, also while the output is not accepting the batch.
+func (fi *FileInput) waitForAck(output chan<- []Event, ackCh <-chan Ack, batch []Event, id uint64) error {
+	// the timer runs once a copy of the batch is sent
+	timer := time.NewTimer(fi.config.ackTimeout)
+	timer.Stop()
+	defer timer.Stop()
+	var timeout <-chan time.Time
+
+	// the output acks every copy, so at most as many copies are sent as the acks that it buffers
+	// for the input while it is not waiting for them
+	pending := output
+	copies := 0
+
+	for {
+		select {
+		case <-fi.abort:
+			return errAborted
+
+		case pending <- batch:
+			pending = nil
+			copies++
+			timer.Reset(fi.config.ackTimeout)
+			timeout = timer.C
+
+		case <-timeout:
+			if copies >= ackBufferSize {
+				fi.log.Warn("ack timed out, batch still pending", "events", len(batch), "batch", id, "copies", copies)
+				timer.Reset(fi.config.ackTimeout)
+				continue
+			}
+			fi.log.Warn("ack timed out, resending batch", "events", len(batch), "batch", id, "timeout", fi.config.ackTimeout)
+			fi.updateStats(func(s *InputStats) { s.Resent++ })
+			timeout = nil
+			pending = output
+
+		case ack, ok := <-ackCh:
+			if !ok {
+				return xerrors.Errorf("ack channel closed")
+			}
+			e := ack.Event()
+			if e.batch != id {
+				fi.log.Warn("orphaned ack", "batch", e.batch, "expected", id, "offset", e.Offset)
+				continue
+			}
+			fi.log.Debug("ack received", "batch", id, "offset", e.Offset, "errors", ack.HasError())
+
+			if ack.HasError() {
+				return xerrors.Errorf("%s; could not dispatch batch with offset %d", *e.Source, e.Offset)
+			}
+
+			offset := fi.ackOffset()
+			err := fi.reg.UpdateOffset(fi.key, offset)
+			if err != nil {
+				return xerrors.Errorf("could not update registry for offset %d: %w", offset, err)
+			}
+			fi.updateStats(func(s *InputStats) {
+				s.Offset = offset
+				s.LastAck = time.Now()
+			})
+
+			return nil
 		}
-		e := ack.Event()
-		fi.log.Printf("%s; ack received for offset %d and hasErrors: %t", *e.Source, e.Offset, ack.HasError())
+	}
+}
 
-		if ack.HasError() {
-			return xerrors.Errorf("%s; could not dispatch batch with offset %d", *e.Source, e.Offset)
+// ackOffset returns the offset up to which the file is read once the pending events are acked,
+// which is the end of the furthest of them, unless dedup still holds an event or a partial
+// container message is pending before it.
+func (fi *FileInput) ackOffset() int64 {
+	var offset int64
+	for _, e := range fi.events {
+		if end := e.Offset + e.size; end > offset {
+			offset = end
 		}
+	}
 
-		err := fi.reg.UpdateOffset(*e.Source, e.Offset+e.GetLength()+1)
-		if err != nil {
-			return xerrors.Errorf("could not update registry for offset %d: %w", e.Offset, err)
+	if fi.dedup != nil {
+		if held, ok := fi.dedup.oldest(); ok && held < offset {
+			offset = held
 		}
+	}
 
-		return nil
+	if fi.container != nil {
+		if pending, ok := fi.container.oldest(); ok && pending < offset {
+			offset = pending
+		}
 	}
+
+	return offset
 }
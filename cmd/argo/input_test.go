@@ -1,37 +1,566 @@
 package main
 
 import (
-	"sync"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestFileInputStart(t *testing.T) {
 	path := "./testdata/test.log"
-	out := make(chan []Event)
-	ack := make(chan Ack)
-	exp := []Event{{&path, 1, 0, map[string]interface{}{"test": "field"}}}
+	exp := []Event{{Source: &path, Line: 1, Text: map[string]interface{}{"test": "field"}, size: 17}}
 
-	input := NewFileInput(testcfg, path, testreg)
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
 
-	go input.Start(out, ack)
+	r := startInput(NewFileInput(testcfg, path, reg, testwatcher), 0)
 
-	events, _ := <-out
-	assertEq(events, exp, t)
+	events := <-r.out
+	assertEq(withoutTimes(events), exp, t)
+
+	r.input.Stop()
+	r.input.Abort()
+	r.wait(t)
 }
 
 func TestFileInputStop(t *testing.T) {
-	path := "./testdata/test.log"
-	out := make(chan []Event)
-	ack := make(chan Ack)
+	var tests = []struct {
+		name   string
+		ack    bool
+		offset int64
+		stats  InputStats
+	}{
+		{"acked", true, 17, InputStats{Path: "./testdata/test.log", Read: 1, Bytes: 17, Events: 1, Offset: 17, Size: 17}},
+		{"aborted", false, 0, InputStats{Path: "./testdata/test.log", Read: 1, Bytes: 17, Size: 17}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg, cleanup := newTestRegistry(t)
+			defer cleanup()
+
+			cfg := *testcfg
+			cfg.dispatchInterval = time.Hour
+
+			path := "./testdata/test.log"
+			r := startInput(NewFileInput(&cfg, path, reg, testwatcher), 0)
+
+			// the pending events are dispatched once the input is stopped
+			time.Sleep(100 * time.Millisecond)
+			r.input.Stop()
+
+			events := <-r.out
+			assertEq(len(events), 1, t)
+			if tt.ack {
+				r.ackLast(events, false)
+			} else {
+				r.input.Abort()
+			}
+			r.wait(t)
+
+			offset, _ := reg.GetOffset(path)
+			assertEq(offset, tt.offset, t)
+			assertEq(statsWithoutTimes(r.input.Stats()), tt.stats, t)
+		})
+	}
+}
+
+func TestFileInputCompressed(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	cfg := *testcfg
+	cfg.ReadCompressed = true
+
+	for _, path := range []string{"./testdata/test.log.gz", "./testdata/test.log.zst"} {
+		t.Run(path, func(t *testing.T) {
+			r := startInput(NewFileInput(&cfg, path, reg, testwatcher), 0)
+
+			events := <-r.out
+			assertEq(len(events), 2, t)
+			assertEq(events[0].Text, map[string]interface{}{"test": "field"}, t)
+			assertEq(events[1].Text, map[string]interface{}{"test": "last"}, t)
+
+			r.ackLast(events, false)
+			r.wait(t)
+
+			// harvested files are never read again
+			r = startInput(NewFileInput(&cfg, path, reg, testwatcher), 0)
+			select {
+			case events := <-r.out:
+				t.Fatalf("unexpected events %v", events)
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestFileInputCompressedInodeReuse(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log.gz")
+
+	cfg := *testcfg
+	cfg.ReadCompressed = true
+
+	// the content is rewritten in place, as by a new file that reuses the inode of a deleted one
+	for _, text := range []string{`{"test":"first"}`, `{"test":"second"}`} {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(text + "\n"))
+		zw.Close()
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		r := startInput(NewFileInput(&cfg, path, reg, testwatcher), 0)
+
+		select {
+		case events := <-r.out:
+			assertEq(len(events), 1, t)
+			assertEq(events[0].Text["test"], text[9:len(text)-2], t)
+			r.ackLast(events, false)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("file with content %s was not read", text)
+		}
+		r.wait(t)
+	}
+}
+
+func TestFileInputOnce(t *testing.T) {
+	var tests = []struct {
+		hasError bool
+		stats    InputStats
+	}{
+		{false, InputStats{Path: "./testdata/test.log", Read: 1, Bytes: 17, Events: 1, Offset: 17, Size: 17}},
+		{true, InputStats{Path: "./testdata/test.log", Read: 1, Bytes: 17, Failed: 1, Errors: 1, Size: 17,
+			LastError: "./testdata/test.log; could not dispatch batch with offset 0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("hasError=%t", tt.hasError), func(t *testing.T) {
+			reg, cleanup := newTestRegistry(t)
+			defer cleanup()
+
+			cfg := *testcfg
+			cfg.once = true
+
+			r := startInput(NewFileInput(&cfg, "./testdata/test.log", reg, nil), 0)
+
+			events := <-r.out
+			r.ackLast(events, tt.hasError)
 
-	input := NewFileInput(testcfg, path, testreg)
+			waitClosed(r.done, "input did not terminate at EOF", t)
+			assertEq(statsWithoutTimes(r.input.Stats()), tt.stats, t)
+		})
+	}
+}
+
+func TestFileInputWatch(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	f, err := ioutil.TempFile("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	cfg := *testcfg
+	cfg.dispatchInterval = 0
+
+	path := f.Name()
+	r := startInput(NewFileInput(&cfg, path, reg, testwatcher), 0)
+	defer func() {
+		r.input.Stop()
+		<-r.done
+	}()
+
+	for _, text := range []string{`{"partial":`, `"line"}` + "\n"} {
+		time.Sleep(100 * time.Millisecond)
+		f.WriteString(text)
+	}
+
+	select {
+	case events := <-r.out:
+		assertEq(events[0].Text, map[string]interface{}{"partial": "line"}, t)
+		r.ackLast(events, false)
+	case <-time.After(5 * time.Second):
+		t.Fatal("input was not notified of the write")
+	}
+}
+
+func TestFileInputFingerprint(t *testing.T) {
+	var tests = []struct {
+		name    string
+		content string
+		offset  int64
+		stats   InputStats
+	}{
+		{"appended", `{"a":1}` + "\n" + `{"a":2}` + "\n", 8, InputStats{Read: 1, Bytes: 8, Events: 1, Offset: 16, Size: 16}},
+		{"replaced", `{"b":1}` + "\n" + `{"b":2}` + "\n", 0, InputStats{Read: 2, Bytes: 16, Events: 2, Resets: 1, Offset: 16, Size: 16}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg, cleanup := newTestRegistry(t)
+			defer cleanup()
+
+			f, err := ioutil.TempFile("", "argo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := f.Name()
+			f.Close()
+			defer os.Remove(path)
+
+			cfg := *testcfg
+			cfg.once = true
+
+			harvest := func() ([]Event, InputStats) {
+				var events []Event
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		input.Start(out, ack)
+				r := startInput(NewFileInput(&cfg, path, reg, nil), 0)
+				for {
+					select {
+					case batch := <-r.out:
+						events = append(events, batch...)
+						r.ackLast(batch, false)
+					case <-r.done:
+						return events, r.input.Stats()
+					}
+				}
+			}
+
+			ioutil.WriteFile(path, []byte(`{"a":1}`+"\n"), 0644)
+			harvest()
+
+			ioutil.WriteFile(path, []byte(tt.content), 0644)
+			events, stats := harvest()
+
+			tt.stats.Path = path
+			assertEq(events[0].Offset, tt.offset, t)
+			assertEq(statsWithoutTimes(stats), tt.stats, t)
+		})
+	}
+}
+
+func TestFileInputCopyTruncate(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	f, err := ioutil.TempFile("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	cfg := *testcfg
+	cfg.dispatchInterval = 0
+
+	path := f.Name()
+	r := startInput(NewFileInput(&cfg, path, reg, testwatcher), 0)
+	defer func() {
+		r.input.Stop()
+		<-r.done
 	}()
-	input.Stop()
-	wg.Wait()
+
+	receive := func() Event {
+		select {
+		case events := <-r.out:
+			r.ackLast(events, false)
+			return events[0]
+		case <-time.After(5 * time.Second):
+			t.Fatal("no events received")
+		}
+		return Event{}
+	}
+
+	f.WriteString(`{"old":"line"}` + "\n")
+	assertEq(receive().Offset, int64(0), t)
+
+	// let the input catch up, then truncate and grow past the previous offset before it notices
+	time.Sleep(100 * time.Millisecond)
+	f.Truncate(0)
+	f.WriteAt([]byte(`{"new":"first line"}`+"\n"), 0)
+
+	e := receive()
+	assertEq(e.Offset, int64(0), t)
+	assertEq(e.Text, map[string]interface{}{"new": "first line"}, t)
+	assertEq(r.input.Stats().Resets, uint64(1), t)
+}
+
+func TestFileInputReplacedWhileReading(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	f, err := ioutil.TempFile("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	for i := 0; i < 4; i++ {
+		fmt.Fprintf(f, `{"old":%d}`+"\n", i)
+	}
+	f.Close()
+
+	cfg := *testcfg
+	cfg.once = true
+	cfg.BatchSize = 1
+
+	r := startInput(NewFileInput(&cfg, path, reg, nil), 0)
+	events := <-r.out
+	assertEq(events[0].Text, map[string]interface{}{"old": 0.0}, t)
+
+	// the content is replaced in the middle of the backlog, and grows past the current offset
+	ioutil.WriteFile(path, []byte(`{"new":"first line"}`+"\n"+`{"new":"second line"}`+"\n"), 0644)
+	time.Sleep(verifyInterval)
+	r.ackLast(events, false)
+
+	events = <-r.out
+	assertEq(events[0].Offset, int64(0), t)
+	assertEq(events[0].Text, map[string]interface{}{"new": "first line"}, t)
+	r.ackLast(events, false)
+	events = <-r.out
+	r.ackLast(events, false)
+	r.wait(t)
+
+	assertEq(r.input.Stats().Resets, uint64(1), t)
+}
+
+func TestFileInputLongLines(t *testing.T) {
+	content := `{"short":1}` + "\n" + `{"long":"` + strings.Repeat("x", 64) + `"}` + "\n" + `{"short":2}` + "\n"
+
+	var tests = []struct {
+		longLines string
+		events    []Event
+	}{
+		{longLinesTruncate, []Event{
+			{Line: 1, Offset: 0, Text: map[string]interface{}{"short": 1.0}, size: 12},
+			{Line: 2, Offset: 12, Text: map[string]interface{}{"message": `{"long":"xxxxxxx`}, Truncated: true, size: 76},
+			{Line: 3, Offset: 88, Text: map[string]interface{}{"short": 2.0}, size: 12},
+		}},
+		{longLinesSkip, []Event{
+			{Line: 1, Offset: 0, Text: map[string]interface{}{"short": 1.0}, size: 12},
+			{Line: 3, Offset: 88, Text: map[string]interface{}{"short": 2.0}, size: 12},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.longLines, func(t *testing.T) {
+			reg, cleanup := newTestRegistry(t)
+			defer cleanup()
+
+			f, err := ioutil.TempFile("", "argo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := f.Name()
+			defer os.Remove(path)
+			f.WriteString(content)
+			f.Close()
+
+			cfg := *testcfg
+			cfg.MaxLineBytes = 16
+			cfg.LongLines = tt.longLines
+
+			events, input := harvestOnce(&cfg, path, reg, t)
+
+			for i := range tt.events {
+				tt.events[i].Source = &path
+			}
+			assertEq(withoutTimes(events), tt.events, t)
+			assertEq(input.Stats().Long, uint64(1), t)
+
+			offset, _ := reg.GetOffset(path)
+			assertEq(offset, int64(len(content)), t)
+		})
+	}
+}
+
+func TestFileInputEncoding(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	f, err := ioutil.TempFile("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+
+	// {"a":"é"}\r\n in UTF-16LE with a byte order mark
+	content := []byte{0xff, 0xfe}
+	for _, r := range `{"a":"é"}` + "\r\n" {
+		content = append(content, byte(r), 0)
+	}
+	f.Write(content)
+	f.Close()
+
+	cfg := *testcfg
+	cfg.Encoding = "utf-16"
+
+	events, _ := harvestOnce(&cfg, path, reg, t)
+
+	assertEq(events[0].Text, map[string]interface{}{"a": "é"}, t)
+
+	offset, _ := reg.GetOffset(path)
+	assertEq(offset, int64(len(content)), t)
+}
+
+func TestFileInputFilter(t *testing.T) {
+	content := `{"level":"debug","service":"api"}` + "\n" +
+		`{"level":"debug","service":"payments"}` + "\n" +
+		`{"level":"info","service":"api","status":503}` + "\n" +
+		`{"level":"info","service":"api","status":200}` + "\n" +
+		`{"level":"info","service":"web"}` + "\n"
+
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	f, err := ioutil.TempFile("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	f.WriteString(content)
+	f.Close()
+
+	cfg := *testcfg
+	cfg.Filter = Filter{Exclude: `level == "debug" && service != "payments"`}
+	cfg.Processors = []ProcessorConfig{
+		{"drop_event": json.RawMessage(`{"when":"service == 'web'"}`)},
+	}
+	cfg.Output = OutputConfig{Filter: Filter{Include: `!exists(status) || status >= 500`}}
+	if err := cfg.Filter.parse(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Output.parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	events, input := harvestOnce(&cfg, path, reg, t)
+
+	lines := make([]uint64, len(events))
+	for i, e := range events {
+		lines[i] = e.Line
+	}
+	assertEq(lines, []uint64{2, 3}, t)
+
+	stats := input.Stats()
+	assertEq(stats.Filtered, uint64(2), t)
+	assertEq(stats.Dropped, uint64(1), t)
+}
+
+func TestFileInputAckTimeout(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	cfg := *testcfg
+	cfg.once = true
+	cfg.ackTimeout = 100 * time.Millisecond
+
+	path := "./testdata/test.log"
+	r := startInput(NewFileInput(&cfg, path, reg, nil), ackBufferSize+1)
+
+	// the batch is sent again whenever its ack times out, until as many copies are pending as
+	// the output buffers acks for
+	time.Sleep(time.Duration(ackBufferSize+2) * cfg.ackTimeout)
+	assertEq(len(r.out), ackBufferSize, t)
+
+	// the copies have the same batch and document ids, so they overwrite each other once indexed
+	first := <-r.out
+	resent := <-r.out
+	assertEq(resent, first, t)
+	assertEq(first[0].id != "", true, t)
+
+	payload, _ := prepareBulkPayload(first)
+	resentPayload, _ := prepareBulkPayload(resent)
+	assertEq(resentPayload.String(), payload.String(), t)
+
+	// the ack of another batch is skipped, while that of either copy is accepted
+	orphan := first[0]
+	orphan.batch++
+	r.ack <- NewAck(orphan, false)
+	r.ackLast(first, false)
+	waitClosed(r.done, "input did not terminate once acked", t)
+
+	offset, _ := reg.GetOffset(path)
+	assertEq(offset, int64(17), t)
+
+	stats := r.input.Stats()
+	assertEq(stats.Events, uint64(1), t)
+	assertEq(stats.Resent, uint64(ackBufferSize-1), t)
+}
+
+func TestFileInputDocumentIDs(t *testing.T) {
+	f, err := ioutil.TempFile("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	f.WriteString(`{"a":1}` + "\n")
+
+	cfg := *testcfg
+
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+	first, _ := harvestOnce(&cfg, path, reg, t)
+
+	// the file grows, and is read again from the start as after a restart without a registry
+	f.WriteString(`{"a":2}` + "\n")
+	f.Close()
+	other, cleanupOther := newTestRegistry(t)
+	defer cleanupOther()
+	again, _ := harvestOnce(&cfg, path, other, t)
+
+	assertEq(len(again), 2, t)
+	assertEq(again[0].id, first[0].id, t)
+	assertEq(again[1].id != again[0].id, true, t)
+
+	// content written after the file is truncated gets other ids at the same offsets
+	ioutil.WriteFile(path, []byte(`{"b":1}`+"\n"), 0644)
+	replaced, cleanupReplaced := newTestRegistry(t)
+	defer cleanupReplaced()
+	events, _ := harvestOnce(&cfg, path, replaced, t)
+	assertEq(events[0].id != first[0].id, true, t)
+}
+
+func TestFileInputAcksWhileSending(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	cfg := *testcfg
+	cfg.once = true
+
+	path := "./testdata/test.log"
+	r := startInput(NewFileInput(&cfg, path, reg, nil), 0)
+
+	// a late ack of another batch is skipped while the output does not accept the batch, so that
+	// an output waiting to deliver it does not wait for the input in turn
+	source := path
+	r.ack <- NewAck(Event{Source: &source, batch: ^uint64(0)}, false)
+	waitFor(t, func() bool { return len(r.ack) == 0 })
+
+	events := <-r.out
+	r.ackLast(events, false)
+	waitClosed(r.done, "input did not terminate once acked", t)
 }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mresvanis/argo/pkg/util"
+)
+
+// InputConfig holds the settings of the files of an input. Any setting that is not set takes its
+// global value, while the fields and tags are added to the global ones.
+type InputConfig struct {
+	Paths            []string         `json:"paths"`
+	Format           string           `json:"format,omitempty"`
+	Encoding         string           `json:"encoding,omitempty"`
+	DeadTime         string           `json:"dead_time,omitempty"`
+	DispatchInterval int64            `json:"dispatch_interval,omitempty"`
+	BatchSize        int64            `json:"batch_size,omitempty"`
+	Multiline        *MultilineConfig `json:"multiline,omitempty"`
+
+	// Output selects the events of the input that are dispatched, and the index they are sent to.
+	Output *OutputConfig `json:"output,omitempty"`
+
+	MetaConfig
+	LimitsConfig
+
+	deadtime         time.Duration
+	dispatchInterval time.Duration
+}
+
+func (ic *InputConfig) parse(cfg *Config) error {
+	if len(ic.Paths) == 0 {
+		return fmt.Errorf("no paths defined")
+	}
+
+	if ic.Format != "" && !contains(formats, ic.Format) {
+		return fmt.Errorf("invalid format %q, expected one of %s", ic.Format, strings.Join(formats, ", "))
+	}
+
+	if ic.Encoding != "" {
+		if _, err := util.LookupEncoding(ic.Encoding); err != nil {
+			return fmt.Errorf("invalid encoding; %s", err)
+		}
+	}
+
+	var err error
+	if ic.DeadTime != "" {
+		ic.deadtime, err = time.ParseDuration(ic.DeadTime)
+		if err != nil || ic.deadtime <= 0 {
+			return fmt.Errorf("invalid dead_time %q", ic.DeadTime)
+		}
+	}
+
+	if ic.DispatchInterval < 0 {
+		return fmt.Errorf("invalid dispatch_interval %d", ic.DispatchInterval)
+	}
+	ic.dispatchInterval = time.Duration(ic.DispatchInterval) * time.Second
+
+	if ic.BatchSize < 0 {
+		return fmt.Errorf("invalid batch_size %d", ic.BatchSize)
+	}
+
+	err = ic.LimitsConfig.parse()
+	if err != nil {
+		return err
+	}
+
+	if ic.Multiline != nil {
+		err = ic.Multiline.parse()
+		if err != nil {
+			return err
+		}
+	}
+
+	if ic.Output != nil {
+		err = ic.Output.parse()
+		if err != nil {
+			return fmt.Errorf("output; %s", err)
+		}
+	}
+
+	// the effective multiline and format of the input must be compatible
+	return cfg.inputOf(ic).validateMultiline()
+}
+
+// parseInputs validates the inputs, in order. The files of the global paths make up an input of
+// their own, with the global settings.
+func (cfg *Config) parseInputs() error {
+	for i := range cfg.Inputs {
+		err := cfg.Inputs[i].parse(cfg)
+		if err != nil {
+			return fmt.Errorf("invalid inputs[%d]; %s", i, err)
+		}
+	}
+
+	if len(cfg.Paths) > 0 {
+		return cfg.validateMultiline()
+	}
+	return nil
+}
+
+// patterns returns the paths of every input.
+func (cfg *Config) patterns() []string {
+	patterns := append([]string(nil), cfg.Paths...)
+	for _, in := range cfg.Inputs {
+		patterns = append(patterns, in.Paths...)
+	}
+	return getUniquePaths(patterns)
+}
+
+// matches reports whether path is harvested by any input.
+func (cfg *Config) matches(path string) bool {
+	return matchesAny(cfg.patterns(), path)
+}
+
+// configOf returns the configuration of the input of the specified path: the one of the first of
+// Inputs whose paths match it, or otherwise the global one.
+func (cfg *Config) configOf(path string) *Config {
+	for i := range cfg.Inputs {
+		if matchesAny(cfg.Inputs[i].Paths, path) {
+			return cfg.inputOf(&cfg.Inputs[i])
+		}
+	}
+	return cfg
+}
+
+// inputOf returns the global configuration with the settings of the input applied. Its fields
+// and tags are added by metaOf.
+func (cfg *Config) inputOf(in *InputConfig) *Config {
+	c := *cfg
+	c.Paths = in.Paths
+	c.Inputs = nil
+
+	if in.Format != "" {
+		c.Format = in.Format
+	}
+	if in.Encoding != "" {
+		c.Encoding = in.Encoding
+	}
+	if in.DeadTime != "" {
+		c.DeadTime = in.DeadTime
+		c.deadtime = in.deadtime
+	}
+	if in.DispatchInterval != 0 {
+		c.DispatchInterval = in.DispatchInterval
+		c.dispatchInterval = in.dispatchInterval
+	}
+	if in.BatchSize != 0 {
+		c.BatchSize = in.BatchSize
+	}
+	if in.Multiline != nil {
+		c.Multiline = *in.Multiline
+	}
+	if in.RateLimit != nil {
+		c.RateLimit = in.RateLimit
+	}
+	if in.Sampling != nil {
+		c.Sampling = in.Sampling
+	}
+	if in.Dedup != nil {
+		c.Dedup = in.Dedup
+	}
+
+	if out := in.Output; out != nil {
+		if out.Index != "" {
+			c.Output.Index = out.Index
+		}
+		if out.Include != "" {
+			c.Output.Include = out.Include
+			c.Output.include = out.include
+		}
+		if out.Exclude != "" {
+			c.Output.Exclude = out.Exclude
+			c.Output.exclude = out.exclude
+		}
+	}
+
+	c.input = in
+
+	return &c
+}
+
+// validateMultiline checks that multiline is only set for JSON lines, as the lines of container
+// logs are split and joined by the container runtime.
+func (cfg *Config) validateMultiline() error {
+	if cfg.Multiline.Pattern != "" && cfg.Format != formatJSON {
+		return fmt.Errorf("multiline is not supported with the %s format", cfg.Format)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigInputs(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(`{
+		"host": "http://localhost:9200",
+		"paths": ["/var/log/app.log"],
+		"dead_time": "12h",
+		"tags": ["global"],
+		"output": {"exclude": "level == \"debug\""},
+		"inputs": [{
+			"paths": ["/var/log/nginx/*.log"],
+			"dead_time": "1h",
+			"dispatch_interval": 1,
+			"batch_size": 500,
+			"tags": ["nginx"],
+			"fields": {"team": "web"},
+			"output": {"index": "nginx"}
+		}, {
+			"paths": ["/var/log/java/*.log", "/var/log/nginx/error.log"],
+			"multiline": {"pattern": "^\\s"}
+		}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEq(cfg.patterns(), []string{"/var/log/app.log", "/var/log/nginx/*.log", "/var/log/java/*.log", "/var/log/nginx/error.log"}, t)
+	assertEq(cfg.matches("/var/log/java/gc.log"), true, t)
+	assertEq(cfg.matches("/var/log/other.log"), false, t)
+
+	// the global paths take the global settings
+	assertEq(cfg.configOf("/var/log/app.log"), cfg, t)
+
+	// the first input that matches applies its settings over the global ones
+	nginx := cfg.configOf("/var/log/nginx/error.log")
+	assertEq(nginx.deadtime, time.Hour, t)
+	assertEq(nginx.dispatchInterval, time.Second, t)
+	assertEq(nginx.BatchSize, int64(500), t)
+	assertEq(nginx.Output.Index, "nginx", t)
+	assertEq(nginx.Output.Exclude, `level == "debug"`, t)
+	assertEq(nginx.Multiline.Pattern, "", t)
+
+	tags, fields, err := nginx.metaOf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEq(tags, []string{"global", "nginx"}, t)
+	assertEq(string(fields), `"fields":{"team":"web"}`, t)
+
+	java := cfg.configOf("/var/log/java/gc.log")
+	assertEq(java.deadtime, 12*time.Hour, t)
+	assertEq(java.BatchSize, int64(128), t)
+	assertEq(java.Output.Index, "", t)
+	assertEq(java.Multiline.Match, "after", t)
+	assertEq(java.Multiline.pattern != nil, true, t)
+
+	// inputs alone are enough
+	_, err = ParseConfig(strings.NewReader(`{"host":"http://localhost:9200","inputs":[{"paths":["./a.log"]}]}`))
+	assertEq(err, nil, t)
+}
+
+func TestConfigInputsErrors(t *testing.T) {
+	tests := []struct {
+		json string
+		err  error
+	}{
+		{
+			`{"host":"http://localhost:9200","inputs":[{"paths":["./a.log"]},{"format":"cri"}]}`,
+			errors.New("invalid inputs[1]; no paths defined"),
+		},
+		{
+			`{"host":"http://localhost:9200","inputs":[{"paths":["./a.log"],"format":"syslog"}]}`,
+			errors.New(`invalid inputs[0]; invalid format "syslog", expected one of json, cri, docker, container`),
+		},
+		{
+			`{"host":"http://localhost:9200","inputs":[{"paths":["./a.log"]},{"paths":["./b.log"],"dead_time":"soon"}]}`,
+			errors.New(`invalid inputs[1]; invalid dead_time "soon"`),
+		},
+		{
+			`{"host":"http://localhost:9200","inputs":[{"paths":["./a.log"],"output":{"index":"Logs"}}]}`,
+			errors.New(`invalid inputs[0]; output; invalid index "Logs"`),
+		},
+		{
+			`{"host":"http://localhost:9200","inputs":[{"paths":["./a.log"],"format":"cri","multiline":{"pattern":"^a"}}]}`,
+			errors.New("invalid inputs[0]; multiline is not supported with the cri format"),
+		},
+		{
+			`{"host":"http://localhost:9200","multiline":{"pattern":"^a"},"inputs":[{"paths":["./a.log"],"format":"docker"}]}`,
+			errors.New("invalid inputs[0]; multiline is not supported with the docker format"),
+		},
+		{
+			`{"host":"http://localhost:9200","fields_under_root":true,"inputs":[{"paths":["./a.log"],"fields":{"host":"x"}}]}`,
+			errors.New(`invalid fields; field "host" conflicts with the event key "host"`),
+		},
+		{
+			`{"host":"http://localhost:9200","inputs":[]}`,
+			errors.New("no paths defined"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			_, err := ParseConfig(strings.NewReader(tt.json))
+			assertEq(err, tt.err, t)
+		})
+	}
+}
+
+func TestHarvesterInputs(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"app.log", "web.log"} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(`{"test":"field"}`+"\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := *testcfg
+	cfg.once = true
+	cfg.Paths = []string{filepath.Join(dir, "app.log")}
+	cfg.Inputs = []InputConfig{{
+		Paths:      []string{filepath.Join(dir, "web*.log")},
+		Output:     &OutputConfig{Index: "web"},
+		MetaConfig: MetaConfig{Tags: []string{"web"}},
+	}}
+	if err := cfg.parseInputs(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := newTestOutput()
+	h := NewHarvester(&cfg, out, reg, nil)
+	h.Start()
+
+	sent := make(map[string]Event)
+	for i := 0; i < 2; i++ {
+		events := receive(out, t)
+		sent[filepath.Base(*events[0].Source)] = events[0]
+		out.ack(events)
+	}
+	h.Wait()
+
+	assertEq(sent["app.log"].Tags, []string(nil), t)
+	assertEq(sent["app.log"].index, "", t)
+	assertEq(sent["web.log"].Tags, []string{"web"}, t)
+	assertEq(sent["web.log"].index, "web", t)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// KubernetesConfig configures the lookup of pod metadata for container logs.
+type KubernetesConfig struct {
+	// Labels enables looking up the labels of pods through the Kubernetes API.
+	Labels bool `json:"labels"`
+
+	// APIServer is the URL of the Kubernetes API, which defaults to the in-cluster service.
+	APIServer string `json:"api_server"`
+
+	// CacheTTL is how long the metadata of a pod is cached.
+	CacheTTL string `json:"cache_ttl"`
+
+	cacheTTL time.Duration
+}
+
+func (kc *KubernetesConfig) parse() error {
+	if kc.CacheTTL == "" {
+		kc.CacheTTL = "1m"
+	}
+
+	var err error
+	kc.cacheTTL, err = time.ParseDuration(kc.CacheTTL)
+	if err != nil || kc.cacheTTL <= 0 {
+		return fmt.Errorf("invalid kubernetes cache_ttl %q", kc.CacheTTL)
+	}
+
+	if kc.APIServer != "" && !validURL(kc.APIServer) {
+		return fmt.Errorf("invalid kubernetes api_server %q, expected an http or https URL", redactURL(kc.APIServer))
+	}
+	return nil
+}
+
+// KubernetesMeta describes the container that wrote an event.
+type KubernetesMeta struct {
+	Namespace string `json:"namespace"`
+	Pod       struct {
+		Name string `json:"name"`
+		UID  string `json:"uid,omitempty"`
+	} `json:"pod"`
+	Container struct {
+		Name string `json:"name"`
+		ID   string `json:"id"`
+	} `json:"container"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// PodMetadata is the metadata of a pod that is not encoded in the log file names.
+type PodMetadata struct {
+	UID    string
+	Labels map[string]string
+}
+
+// PodMetadataProvider looks up the metadata of pods.
+type PodMetadataProvider interface {
+	// PodMetadata returns the metadata of the pod with the specified namespace and name.
+	PodMetadata(namespace, name string) (*PodMetadata, error)
+}
+
+// APIPodProvider looks up pods through the Kubernetes API, authenticating with the service
+// account of the pod that argo runs in.
+type APIPodProvider struct {
+	server string
+	token  string
+	client *http.Client
+}
+
+// NewAPIPodProvider returns a provider for the specified API server, or the in-cluster one if
+// empty.
+func NewAPIPodProvider(server string) (*APIPodProvider, error) {
+	p := new(APIPodProvider)
+
+	p.server = server
+	if p.server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("kubernetes api_server not defined and not running in a cluster")
+		}
+		p.server = "https://" + net.JoinHostPort(host, port)
+	}
+
+	token, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read service account token; %s", err)
+	}
+	p.token = string(token)
+
+	tlsConfig := new(tls.Config)
+	ca, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err == nil {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM(ca)
+	}
+
+	p.client = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	return p, nil
+}
+
+func (p *APIPodProvider) PodMetadata(namespace, name string) (*PodMetadata, error) {
+	u := fmt.Sprintf("%s/api/v1/namespaces/%s/pods/%s", p.server, url.PathEscape(namespace), url.PathEscape(name))
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not get pod %s/%s; %s", namespace, name, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not get pod %s/%s; %s", namespace, name, res.Status)
+	}
+
+	var pod struct {
+		Metadata struct {
+			UID    string            `json:"uid"`
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&pod); err != nil {
+		return nil, fmt.Errorf("could not decode pod %s/%s; %s", namespace, name, err)
+	}
+
+	return &PodMetadata{UID: pod.Metadata.UID, Labels: pod.Metadata.Labels}, nil
+}
+
+type podCacheEntry struct {
+	meta    *PodMetadata
+	err     error
+	expires time.Time
+	ready   chan struct{} // closed once the lookup completes
+}
+
+// PodCache caches the metadata, and the failures, of another provider, so that the pods of busy
+// containers are not looked up for every event.
+type PodCache struct {
+	sync.Mutex
+
+	provider PodMetadataProvider
+	ttl      time.Duration
+	entries  map[string]*podCacheEntry
+}
+
+func NewPodCache(provider PodMetadataProvider, ttl time.Duration) *PodCache {
+	c := new(PodCache)
+
+	c.provider = provider
+	c.ttl = ttl
+	c.entries = make(map[string]*podCacheEntry)
+
+	return c
+}
+
+// PodMetadata returns the cached metadata of the pod, or looks it up without holding the cache,
+// so that a slow API server only delays the inputs of that pod. Concurrent lookups of the same
+// pod wait for the one in flight.
+func (c *PodCache) PodMetadata(namespace, name string) (*PodMetadata, error) {
+	key := namespace + "/" + name
+
+	c.Lock()
+	now := time.Now()
+	if entry, ok := c.entries[key]; ok {
+		select {
+		case <-entry.ready:
+			if now.Before(entry.expires) {
+				c.Unlock()
+				return entry.meta, entry.err
+			}
+		default:
+			c.Unlock()
+			<-entry.ready
+			return entry.meta, entry.err
+		}
+	}
+
+	// drop the expired entries, so that the pods that are gone do not accumulate
+	for k, entry := range c.entries {
+		select {
+		case <-entry.ready:
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		default:
+		}
+	}
+
+	entry := &podCacheEntry{ready: make(chan struct{})}
+	c.entries[key] = entry
+	c.Unlock()
+
+	entry.meta, entry.err = c.provider.PodMetadata(namespace, name)
+	entry.expires = time.Now().Add(c.ttl)
+	close(entry.ready)
+
+	return entry.meta, entry.err
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/mresvanis/argo/pkg/ratelimit"
+)
+
+// Modes of the rate limit of an input.
+const (
+	rateLimitBackpressure = "backpressure"
+	rateLimitDrop         = "drop"
+)
+
+// LimitsConfig limits the events that an input sends to the output.
+type LimitsConfig struct {
+	RateLimit *RateLimitConfig `json:"rate_limit,omitempty"`
+	Sampling  *SamplingConfig  `json:"sampling,omitempty"`
+	Dedup     *DedupConfig     `json:"dedup,omitempty"`
+}
+
+// RateLimitConfig limits the events and bytes per second that an input reads. Either limit may
+// be zero to disable it.
+type RateLimitConfig struct {
+	EventsPerSec float64 `json:"events_per_sec"`
+	BytesPerSec  float64 `json:"bytes_per_sec"`
+
+	// Mode is either backpressure, which slows down reading the file, or drop, which drops the
+	// events over the limit.
+	Mode string `json:"mode"`
+}
+
+// SamplingConfig keeps a fraction of the events. With a field, the decision is a hash of the
+// field value, so that all the events with the same value are either kept or dropped together;
+// events without the field and, without a field, all events are sampled at random.
+type SamplingConfig struct {
+	Rate  float64 `json:"rate"`
+	Field string  `json:"field"`
+}
+
+func (lc *LimitsConfig) parse() error {
+	if rl := lc.RateLimit; rl != nil {
+		if rl.EventsPerSec < 0 || rl.BytesPerSec < 0 {
+			return fmt.Errorf("invalid rate_limit; limits must not be negative")
+		}
+
+		switch rl.Mode {
+		case "":
+			rl.Mode = rateLimitBackpressure
+		case rateLimitBackpressure, rateLimitDrop:
+		default:
+			return fmt.Errorf("invalid rate_limit mode %q, expected %q or %q", rl.Mode, rateLimitBackpressure, rateLimitDrop)
+		}
+	}
+
+	if s := lc.Sampling; s != nil {
+		if s.Rate < 0 || s.Rate > 1 {
+			return fmt.Errorf("invalid sampling rate %g, expected a value from 0 to 1", s.Rate)
+		}
+	}
+
+	if lc.Dedup != nil {
+		if err := lc.Dedup.parse(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// limiter enforces the rate limit of an input.
+type limiter struct {
+	mode   string
+	events *ratelimit.Bucket
+	bytes  *ratelimit.Bucket
+}
+
+// newLimiter returns the limiter of the configuration, or nil if it does not limit anything. The
+// buckets hold a second worth of tokens, which is the largest burst allowed.
+func newLimiter(cfg *RateLimitConfig) *limiter {
+	if cfg == nil || cfg.EventsPerSec == 0 && cfg.BytesPerSec == 0 {
+		return nil
+	}
+
+	l := &limiter{mode: cfg.Mode}
+	if cfg.EventsPerSec > 0 {
+		l.events = ratelimit.NewBucket(cfg.EventsPerSec, math.Max(cfg.EventsPerSec, 1))
+	}
+	if cfg.BytesPerSec > 0 {
+		l.bytes = ratelimit.NewBucket(cfg.BytesPerSec, cfg.BytesPerSec)
+	}
+	return l
+}
+
+// allow reports whether an event of the specified size is within the limit, for the drop mode.
+func (l *limiter) allow(size int64) bool {
+	if l.events != nil && !l.events.Take(1) {
+		return false
+	}
+	return l.bytes == nil || l.bytes.Take(float64(size))
+}
+
+// wait returns how long to pause reading after an event of the specified size, for the
+// backpressure mode.
+func (l *limiter) wait(size int64) time.Duration {
+	var wait time.Duration
+	if l.events != nil {
+		wait = l.events.Reserve(1)
+	}
+	if l.bytes != nil {
+		if w := l.bytes.Reserve(float64(size)); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+// sampler keeps a fraction of the events.
+type sampler struct {
+	rate  float64
+	field string
+	rand  *rand.Rand
+}
+
+func newSampler(cfg *SamplingConfig) *sampler {
+	if cfg == nil || cfg.Rate >= 1 {
+		return nil
+	}
+
+	return &sampler{
+		rate:  cfg.Rate,
+		field: cfg.Field,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// keep reports whether the event is sampled.
+func (s *sampler) keep(e *Event) bool {
+	if s.field != "" {
+		if v, ok := lookupField(e.Text, s.field); ok {
+			h := fnv.New64a()
+			fmt.Fprint(h, v)
+			return float64(mix(h.Sum64()))/math.MaxUint64 < s.rate
+		}
+	}
+	return s.rand.Float64() < s.rate
+}
+
+// mix spreads the bits of a hash, since the high bits of FNV hashes of similar values are alike.
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigInputLimits(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(`{
+		"host": "http://localhost:9200",
+		"paths": ["/var/log/*.log"],
+		"rate_limit": {"events_per_sec": 100},
+		"sampling": {"rate": 0.5},
+		"inputs": [
+			{"paths": ["/var/log/noisy-api.log"], "rate_limit": {"bytes_per_sec": 1024, "mode": "drop"}},
+			{"paths": ["/var/log/noisy*.log"], "sampling": {"rate": 0.1, "field": "trace.id"}}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		path      string
+		rateLimit RateLimitConfig
+		sampling  SamplingConfig
+	}{
+		{"/var/log/app.log", RateLimitConfig{EventsPerSec: 100, Mode: "backpressure"}, SamplingConfig{Rate: 0.5}},
+		{"/var/log/noisy-web.log", RateLimitConfig{EventsPerSec: 100, Mode: "backpressure"}, SamplingConfig{Rate: 0.1, Field: "trace.id"}},
+		{"/var/log/noisy-api.log", RateLimitConfig{BytesPerSec: 1024, Mode: "drop"}, SamplingConfig{Rate: 0.5}},
+	}
+
+	for _, tt := range tests {
+		limits := cfg.configOf(tt.path).LimitsConfig
+		assertEq(*limits.RateLimit, tt.rateLimit, t)
+		assertEq(*limits.Sampling, tt.sampling, t)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	path := "test.log"
+	event := func(text string) *Event {
+		e := NewEvent(&path, 1, 0, &text)
+		return &e
+	}
+
+	s := newSampler(&SamplingConfig{Rate: 0.3, Field: "user"})
+	s.rand = rand.New(rand.NewSource(1))
+
+	var kept int
+	for i := 0; i < 1000; i++ {
+		e := event(fmt.Sprintf(`{"user":"user-%d"}`, i))
+		keep := s.keep(e)
+		if keep {
+			kept++
+		}
+
+		// the same value is always sampled the same way
+		for j := 0; j < 3; j++ {
+			assertEq(s.keep(e), keep, t)
+		}
+	}
+	if kept < 250 || kept > 350 {
+		t.Fatalf("expected about 300 of 1000 users to be kept, got %d", kept)
+	}
+
+	kept = 0
+	for i := 0; i < 1000; i++ {
+		if s.keep(event(`{"message":"without user"}`)) {
+			kept++
+		}
+	}
+	if kept < 250 || kept > 350 {
+		t.Fatalf("expected about 300 of 1000 events to be kept, got %d", kept)
+	}
+
+	none := newSampler(&SamplingConfig{Rate: 0})
+	assertEq(none.keep(event(`{}`)), false, t)
+
+	if newSampler(&SamplingConfig{Rate: 1}) != nil {
+		t.Fatal("expected no sampler for a rate of 1")
+	}
+}
+
+func TestFileInputRateLimit(t *testing.T) {
+	var tests = []struct {
+		name        string
+		rateLimit   RateLimitConfig
+		lines       int
+		events      int
+		rateLimited uint64
+		throttled   time.Duration
+	}{
+		{"drop", RateLimitConfig{EventsPerSec: 5, Mode: rateLimitDrop}, 20, 5, 15, 0},
+		{"backpressure", RateLimitConfig{EventsPerSec: 50, Mode: rateLimitBackpressure}, 60, 60, 0, 150 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg, cleanup := newTestRegistry(t)
+			defer cleanup()
+
+			f, err := ioutil.TempFile("", "argo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := f.Name()
+			defer os.Remove(path)
+			for i := 0; i < tt.lines; i++ {
+				fmt.Fprintf(f, `{"line":%d}`+"\n", i)
+			}
+			f.Close()
+
+			cfg := *testcfg
+			cfg.RateLimit = &tt.rateLimit
+
+			events, input := harvestOnce(&cfg, path, reg, t)
+
+			stats := input.Stats()
+			assertEq(len(events), tt.events, t)
+			assertEq(stats.RateLimited, tt.rateLimited, t)
+			if stats.Throttled < tt.throttled {
+				t.Fatalf("expected reading to be throttled for at least %s, got %s", tt.throttled, stats.Throttled)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mresvanis/argo/pkg/logging"
+)
+
+// components are the parts of argo that have their own logger, and may have their own level.
+var components = []string{"main", "harvester", "file", "out", "es", "reg", "watch", "http", "monitor"}
+
+// LogConfig configures the logs of argo itself, which are written to stderr.
+type LogConfig struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
+
+	// Levels overrides the level of the named components.
+	Levels map[string]string `json:"levels"`
+
+	level  logging.Level
+	levels map[string]logging.Level
+}
+
+func (lc *LogConfig) parse() error {
+	var err error
+
+	if lc.Level == "" {
+		lc.Level = "info"
+	}
+	lc.level, err = logging.ParseLevel(lc.Level)
+	if err != nil {
+		return fmt.Errorf("invalid log level; %s", err)
+	}
+
+	if lc.Format == "" {
+		lc.Format = logging.FormatLogfmt
+	}
+	if !contains(logging.Formats, lc.Format) {
+		return fmt.Errorf("invalid log format %q, expected one of %s", lc.Format, strings.Join(logging.Formats, ", "))
+	}
+
+	names := make([]string, 0, len(lc.Levels))
+	for name := range lc.Levels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !contains(components, name) {
+			return fmt.Errorf("invalid log levels; unknown component %q, expected one of %s", name, strings.Join(components, ", "))
+		}
+
+		level, err := logging.ParseLevel(lc.Levels[name])
+		if err != nil {
+			return fmt.Errorf("invalid log level of %s; %s", name, err)
+		}
+		if lc.levels == nil {
+			lc.levels = make(map[string]logging.Level)
+		}
+		lc.levels[name] = level
+	}
+
+	return nil
+}
+
+// newLogger returns the root logger of the configuration, writing to w.
+func (lc *LogConfig) newLogger(w io.Writer) *logging.Logger {
+	return logging.New(w, lc.Format, lc.level, lc.levels)
+}
+
+// logger returns the logger of the specified component. Configurations that were not loaded by
+// the process, such as those of tests, log at the info level.
+func (cfg *Config) logger(component string) *logging.Logger {
+	root := cfg.log
+	if root == nil {
+		root = logging.New(os.Stderr, logging.FormatLogfmt, logging.InfoLevel, nil)
+	}
+	return root.Component(component)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mresvanis/argo/pkg/logging"
+)
+
+func TestLogConfig(t *testing.T) {
+	lc := LogConfig{Level: "warn", Format: "json", Levels: map[string]string{"es": "debug"}}
+	if err := lc.parse(); err != nil {
+		t.Fatal(err)
+	}
+	if lc.level != logging.WarnLevel || lc.levels["es"] != logging.DebugLevel {
+		t.Fatalf("unexpected levels %s and %v", lc.level, lc.levels)
+	}
+
+	var buf bytes.Buffer
+	cfg := &Config{Log: lc}
+	cfg.log = cfg.Log.newLogger(&buf)
+
+	cfg.logger("file").Info("silenced")
+	cfg.logger("es").Debug("indexed documents", "indexed", 128)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"component":"es","msg":"indexed documents","indexed":128}`) {
+		t.Fatalf("unexpected records:\n%s", buf.String())
+	}
+}
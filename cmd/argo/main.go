@@ -1,52 +1,106 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"log"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/mresvanis/argo/pkg/conffile"
 	"github.com/mresvanis/argo/pkg/registry"
+	"github.com/mresvanis/argo/pkg/watch"
 	"github.com/urfave/cli"
 )
 
 const Version = "0.1.0"
 
+// unreachableInterval is how often --once checks whether the host can be reached.
+const unreachableInterval = 1 * time.Second
+
 // populated at build-time with -ldflags
 var VersionSuffix string
 
+// version returns the version of argo, including the build suffix if any.
+func version() string {
+	if len(VersionSuffix) > 7 {
+		return Version + "-" + VersionSuffix[:7]
+	}
+	if VersionSuffix != "" {
+		return Version + "-" + VersionSuffix
+	}
+	return Version
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "argo"
 	app.Usage = "A simple JSON log forwarder to ES"
 	app.HideVersion = false
-	app.Version = Version
-	if VersionSuffix != "" {
-		app.Version = Version + "-" + VersionSuffix[:7]
-	}
+	app.Version = version()
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
 			Name:  "config, c",
 			Value: "config.json",
-			Usage: "Load configuration from `FILE`",
+			Usage: "Load configuration from `FILE`, in JSON, YAML or TOML by its extension",
 		},
 		cli.StringFlag{
 			Name:  "registry, r",
 			Value: "argo.db",
 			Usage: "Use the specified bolt db `FILE`",
 		},
+		cli.BoolFlag{
+			Name:  "once",
+			Usage: "Read every file to EOF, wait for the acks and exit",
+		},
+		cli.BoolFlag{
+			Name:  "watch-config",
+			Usage: "Reload the configuration when its file changes, as on SIGHUP",
+		},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:  "status",
+			Usage: "Show the state of every file being harvested by a running process",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "address, a",
+					Usage: "Query the process at `ADDRESS` instead of the http.listen of the configuration",
+				},
+			},
+			Action: status,
+		},
+		{
+			Name:  "config",
+			Usage: "Check or print the configuration",
+			Subcommands: []cli.Command{
+				{
+					Name:   "validate",
+					Usage:  "Check the configuration and that the files of its paths can be read",
+					Action: validateConfig,
+				},
+				{
+					Name:   "show",
+					Usage:  "Print the effective configuration, with the defaults applied and the secrets redacted",
+					Action: showConfig,
+				},
+			},
+		},
 	}
 	app.Action = func(c *cli.Context) error {
 		cfg, err := parseConfigFromCli(c)
 		if err != nil {
 			return err
 		}
-		reg, err := loadRegistryFromCli(c)
+		reg, err := loadRegistryFromCli(c, cfg)
 		if err != nil {
 			return err
 		}
+		defer reg.Close()
+
 		return StartProcess(cfg, reg)
 	}
 
@@ -59,32 +113,206 @@ func main() {
 
 // StartProcess spawns the output and inputs given a config.
 func StartProcess(cfg *Config, reg registry.Registrar) error {
+	var err error
+	cfg.host, err = NewHostMeta()
+	if err != nil {
+		return err
+	}
+	cfg.agent, err = NewAgentMeta(reg)
+	if err != nil {
+		return err
+	}
+	if cfg.Kubernetes.Labels {
+		provider, err := NewAPIPodProvider(cfg.Kubernetes.APIServer)
+		if err != nil {
+			return err
+		}
+		cfg.pods = NewPodCache(provider, cfg.Kubernetes.cacheTTL)
+	}
+
+	if cfg.once {
+		return startOnce(cfg, reg)
+	}
+
+	// listen before starting anything, so that an unusable address fails the process cleanly
+	var srv *Server
+	if cfg.HTTP.Listen != "" {
+		cfg.metrics = NewMetrics()
+		reg = cfg.metrics.instrument(reg)
+
+		srv = NewServer(cfg)
+		if err := srv.Start(); err != nil {
+			return fmt.Errorf("cannot start http server; %s", err)
+		}
+		defer srv.Stop()
+	}
+
 	var wg sync.WaitGroup
 
+	watcher := watch.New(pollInterval, cfg.logger("watch"))
+	defer watcher.Close()
+
 	out := startOutput(cfg, &wg)
-	fis := startInputs(cfg, out, reg, &wg)
+	h := startHarvester(cfg, out, reg, watcher, &wg)
+
+	if srv != nil {
+		cfg.metrics.collectOutput(out)
+		cfg.metrics.collectInputs(h)
 
-	handleIntTermSignals(out, fis, reg, &wg)
+		hc := NewHealthChecker(cfg, out, h)
+		srv.Handle("/healthz", healthHandler(hc.Live))
+		srv.Handle("/readyz", healthHandler(hc.Ready))
+		srv.Handle("/status", statusHandler(h))
+	}
+
+	var mon *Monitor
+	if cfg.Monitoring.Enabled {
+		mon = NewMonitor(cfg, out, h)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mon.Start()
+		}()
+	}
+
+	term := make(chan struct{})
+	defer close(term)
+
+	if cfg.path != "" {
+		r := NewReloader(cfg.path, cfg, out, h)
+		handleHupSignals(r, term)
+		if cfg.watch {
+			go r.Watch(watcher, term)
+		}
+	}
+
+	handleIntTermSignals(cfg, out, h, mon, reg, &wg)
 
 	wg.Wait()
-	log.Printf("process terminated")
+	cfg.logger("main").Info("process terminated")
+	return nil
+}
+
+// startOnce spawns the output and inputs given a config, waits for every input to read its
+// file to EOF and returns an error if any of them failed, or if the host could not be reached
+// for the shutdown_timeout.
+func startOnce(cfg *Config, reg registry.Registrar) error {
+	var wg sync.WaitGroup
+
+	start := time.Now()
+
+	out := startOutput(cfg, &wg)
+
+	h := NewHarvester(cfg, out, reg, nil)
+	h.Start()
+
+	stop := make(chan struct{})
+	unreachable := make(chan bool, 1)
+	go func() {
+		unreachable <- abortIfUnreachable(cfg, out, h, stop)
+	}()
+
+	h.Wait()
+	out.Stop()
+	wg.Wait()
+
+	close(stop)
+	if <-unreachable {
+		return fmt.Errorf("could not reach host for %s, the remaining events are sent on the next run", cfg.shutdownTimeout)
+	}
+
+	stats := h.Stats()
+
+	var events, errors, dropped uint64
+	for _, s := range stats {
+		events += s.Events
+		errors += s.Errors
+		dropped += s.Dropped + s.Filtered + s.Sampled + s.RateLimited
+	}
+
+	cfg.logger("main").Info("harvested files",
+		"files", len(stats),
+		"events", events,
+		"dropped", dropped,
+		"errors", errors,
+		"took", time.Since(start).Truncate(time.Millisecond),
+	)
+
+	if errors > 0 {
+		return fmt.Errorf("harvesting finished with %d errors", errors)
+	}
 	return nil
 }
 
 func parseConfigFromCli(c *cli.Context) (*Config, error) {
-	f, err := os.Open(c.String("config"))
+	cfg, err := parseConfigFile(c.String("config"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.once = c.Bool("once")
+	cfg.path = c.String("config")
+	cfg.watch = c.Bool("watch-config")
+	cfg.log = cfg.Log.newLogger(os.Stderr)
+
+	return cfg, nil
+}
+
+// parseConfigFile parses the configuration file at path, in the format of its extension, merged
+// with the files it includes.
+func parseConfigFile(path string) (*Config, error) {
+	docs, err := conffile.Load(path, os.LookupEnv)
 	if err != nil {
 		return nil, fmt.Errorf("cannot parse configuration; %s", err)
 	}
-	cfg, err := ParseConfig(f)
+
+	// decode every file on its own first, so that unknown settings and type errors point at
+	// the file
+	for _, doc := range docs {
+		data, err := json.Marshal(doc.Data)
+		if err == nil {
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.DisallowUnknownFields()
+			err = dec.Decode(new(Config))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse configuration; %s: %s", doc.Path, decodeError(err))
+		}
+	}
+
+	data, err := json.Marshal(conffile.Merge(docs))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("cannot parse configuration; %s", err)
 	}
-	return cfg, nil
+
+	return ParseConfig(bytes.NewReader(data))
 }
 
-func loadRegistryFromCli(c *cli.Context) (registry.Registrar, error) {
-	reg := registry.NewRegistry(c.String("registry"))
+// status prints the state of the files harvested by the process that listens on the address of
+// the status command or of the configuration.
+func status(c *cli.Context) error {
+	address := c.String("address")
+	if address == "" {
+		cfg, err := parseConfigFile(c.GlobalString("config"))
+		if err != nil {
+			return err
+		}
+		if cfg.HTTP.Listen == "" {
+			return fmt.Errorf("http.listen is not configured, so the status is not served")
+		}
+		address = cfg.HTTP.Listen
+	}
+
+	statuses, err := fetchStatus(address)
+	if err != nil {
+		return fmt.Errorf("cannot get status from %s; %s", address, err)
+	}
+
+	return renderStatus(os.Stdout, statuses, time.Now())
+}
+
+func loadRegistryFromCli(c *cli.Context, cfg *Config) (registry.Registrar, error) {
+	reg := registry.NewRegistry(c.String("registry"), cfg.logger("reg"))
 
 	err := reg.Open()
 	if err != nil {
@@ -108,41 +336,120 @@ func getUniquePaths(paths []string) []string {
 	return u
 }
 
-func handleIntTermSignals(out Output, fis []Input, reg registry.Registrar, wg *sync.WaitGroup) {
+// abortIfUnreachable aborts the inputs and the output once the host has been unreachable for the
+// shutdown_timeout, as the batches would otherwise be retried forever. It returns whether it
+// aborted, once it does or stop is closed.
+func abortIfUnreachable(cfg *Config, out Output, h *Harvester, stop <-chan struct{}) bool {
+	ticker := time.NewTicker(unreachableInterval)
+	defer ticker.Stop()
+
+	since := time.Now()
+	for {
+		select {
+		case <-stop:
+			return false
+		case <-ticker.C:
+		}
+
+		health := out.Health()
+		if health.Connected {
+			since = time.Now()
+			continue
+		}
+		if time.Since(since) < cfg.shutdownTimeout {
+			continue
+		}
+
+		cfg.logger("main").Error("host unreachable, abandoning batches in flight", "for", cfg.shutdownTimeout, "error", health.LastError)
+		h.Abort()
+		out.Abort()
+		return true
+	}
+}
+
+// handleHupSignals reloads the configuration on SIGHUP, until term is closed.
+func handleHupSignals(r *Reloader, term <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hup)
+
+		for {
+			select {
+			case <-term:
+				return
+			case <-hup:
+				r.log.Info("process notified, reloading configuration", "signal", syscall.SIGHUP)
+				if err := r.Reload(); err != nil {
+					r.log.Error("could not reload configuration", "path", r.path, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// handleIntTermSignals shuts the process down on SIGINT or SIGTERM: the inputs stop reading and
+// dispatch their pending events, then the output sends the batches left in its queue. Whatever is
+// still in flight after the shutdown_timeout, or on a second signal, is abandoned and read again
+// on the next start, as the offsets only advance on acks.
+func handleIntTermSignals(cfg *Config, out Output, h *Harvester, mon *Monitor, reg registry.Registrar, wg *sync.WaitGroup) {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
-		gracefulTerm := make(chan os.Signal, 1)
+		log := cfg.logger("main")
+
+		gracefulTerm := make(chan os.Signal, 2)
 		signal.Notify(gracefulTerm, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(gracefulTerm)
+
 		sig := <-gracefulTerm
-		log.Printf("process notified, %+v", sig)
+		log.Info("process notified, shutting down", "signal", sig, "timeout", cfg.shutdownTimeout)
+		start := time.Now()
+
+		stopped := make(chan struct{})
+		defer close(stopped)
+
+		go func() {
+			timer := time.NewTimer(cfg.shutdownTimeout)
+			defer timer.Stop()
+
+			select {
+			case <-stopped:
+				return
+			case <-timer.C:
+				log.Warn("shutdown timed out, abandoning batches in flight")
+			case sig := <-gracefulTerm:
+				log.Warn("process notified again, abandoning batches in flight", "signal", sig)
+			}
+			h.Abort()
+			out.Abort()
+		}()
 
-		for _, fi := range fis {
-			fi.Stop()
+		if mon != nil {
+			mon.Stop()
 		}
 
+		h.Stop()
+		h.Wait()
 		out.Stop()
+
+		log.Info("shut down", "took", time.Since(start).Truncate(time.Millisecond))
 	}()
 }
 
-func startInputs(cfg *Config, out Output, reg registry.Registrar, wg *sync.WaitGroup) []Input {
-	paths := getUniquePaths(cfg.Paths)
-
-	fis := make([]Input, 0, len(paths))
-	for _, path := range paths {
-		fi := NewFileInput(cfg, path, reg)
+func startHarvester(cfg *Config, out Output, reg registry.Registrar, watcher watch.Watcher, wg *sync.WaitGroup) *Harvester {
+	h := NewHarvester(cfg, out, reg, watcher)
 
-		wg.Add(1)
-		go func(path string) {
-			defer wg.Done()
-			fi.Start(out.Input(), out.Subscribe(path))
-		}(path)
-
-		fis = append(fis, fi)
-	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.Start()
+		h.Wait()
+	}()
 
-	return fis
+	return h
 }
 
 func startOutput(cfg *Config, wg *sync.WaitGroup) Output {
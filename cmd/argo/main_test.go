@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAbortIfUnreachable(t *testing.T) {
+	cfg := *testcfg
+	cfg.shutdownTimeout = 100 * time.Millisecond
+
+	tests := []struct {
+		name      string
+		connected bool
+		aborted   bool
+	}{
+		{"connected", true, false},
+		{"unreachable", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg, cleanup := newTestRegistry(t)
+			defer cleanup()
+
+			out := &healthOutput{testOutput: newTestOutput(), health: OutputHealth{Connected: tt.connected}}
+			h := NewHarvester(&cfg, out, reg, nil)
+
+			stop := make(chan struct{})
+			aborted := make(chan bool, 1)
+			go func() {
+				aborted <- abortIfUnreachable(&cfg, out, h, stop)
+			}()
+
+			select {
+			case res := <-aborted:
+				assertEq(res, tt.aborted, t)
+			case <-time.After(2 * unreachableInterval):
+				close(stop)
+				assertEq(<-aborted, tt.aborted, t)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// Methods of the mask processor.
+const (
+	maskFixed = "fixed"
+	maskHMAC  = "hmac"
+
+	defaultMask = "[REDACTED]"
+)
+
+// detector finds sensitive values in strings; valid, if set, rejects false positives.
+type detector struct {
+	re    *regexp.Regexp
+	valid func(string) bool
+}
+
+var detectors = map[string]detector{
+	"credit_card": {regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), luhn},
+	"email":       {regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`), nil},
+	"jwt":         {regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), nil},
+}
+
+// maskConfig configures the mask processor.
+type maskConfig struct {
+	// Fields matches the names of keys, at any depth, whose whole values are masked.
+	Fields string `json:"fields"`
+
+	// Patterns match the parts of string values that are masked.
+	Patterns []string `json:"patterns"`
+
+	// Detectors are built in patterns: credit_card, email and jwt.
+	Detectors []string `json:"detectors"`
+
+	// Method replaces values either with the fixed Mask or with their HMAC-SHA256 under Key, so
+	// that masked values can still be joined.
+	Method string `json:"method"`
+	Mask   string `json:"mask"`
+	Key    string `json:"key"`
+}
+
+// mask replaces sensitive values of the event text.
+type mask struct {
+	fields   *regexp.Regexp
+	patterns []detector
+	replace  func(string) string
+}
+
+func newMask(args json.RawMessage) (Processor, error) {
+	var cfg maskConfig
+	err := decodeArgs(args, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(mask)
+
+	if cfg.Fields != "" {
+		m.fields, err = regexp.Compile(cfg.Fields)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fields %q; %s", cfg.Fields, err)
+		}
+	}
+
+	for _, name := range cfg.Detectors {
+		d, ok := detectors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown detector %q", name)
+		}
+		m.patterns = append(m.patterns, d)
+	}
+
+	for _, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q; %s", pattern, err)
+		}
+		m.patterns = append(m.patterns, detector{re: re})
+	}
+
+	if m.fields == nil && len(m.patterns) == 0 {
+		return nil, fmt.Errorf("no fields, patterns or detectors defined")
+	}
+
+	switch cfg.Method {
+	case "", maskFixed:
+		if cfg.Mask == "" {
+			cfg.Mask = defaultMask
+		}
+		m.replace = func(string) string { return cfg.Mask }
+
+	case maskHMAC:
+		if cfg.Key == "" {
+			return nil, fmt.Errorf("hmac method requires a key")
+		}
+		key := []byte(cfg.Key)
+		m.replace = func(s string) string {
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte(s))
+			return hex.EncodeToString(mac.Sum(nil))
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid method %q, expected %q or %q", cfg.Method, maskFixed, maskHMAC)
+	}
+
+	return m, nil
+}
+
+func (m *mask) Process(e *Event) (bool, error) {
+	m.walk(e.Text)
+	return true, nil
+}
+
+// walk masks the values of a decoded JSON object or array in place, and returns the masked
+// value of anything else.
+func (m *mask) walk(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if m.fields != nil && m.fields.MatchString(key) {
+				v[key] = m.maskValue(val)
+				continue
+			}
+			v[key] = m.walk(val)
+		}
+		return v
+
+	case []interface{}:
+		for i, val := range v {
+			v[i] = m.walk(val)
+		}
+		return v
+
+	case string:
+		return m.maskString(v)
+	}
+	return v
+}
+
+// maskValue masks a whole value; objects, arrays and numbers are masked as their JSON encoding.
+func (m *mask) maskValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return m.replace(v)
+	}
+
+	encoded, _ := json.Marshal(v)
+	return m.replace(string(encoded))
+}
+
+func (m *mask) maskString(s string) string {
+	for _, d := range m.patterns {
+		s = d.re.ReplaceAllStringFunc(s, func(match string) string {
+			if d.valid != nil && !d.valid(match) {
+				return match
+			}
+			return m.replace(match)
+		})
+	}
+	return s
+}
+
+// luhn reports whether the digits of s, ignoring separators, pass the Luhn checksum of card
+// numbers.
+func luhn(s string) bool {
+	var sum, n int
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+
+	"github.com/mresvanis/argo/pkg/registry"
+)
+
+const defaultFieldsRoot = "fields"
+
+// reservedKeys are the top level keys of the event document, which fields placed at the top
+// level may not replace.
+var reservedKeys = []string{
+	"@timestamp", "source", "line", "offset", "text", "truncated", "event", "stream",
+	"host", "agent", "tags", "kubernetes", "repeat_count", "first_timestamp", "last_timestamp",
+	"monitoring",
+}
+
+// HostMeta describes the host that argo runs on.
+type HostMeta struct {
+	Hostname     string   `json:"hostname"`
+	IP           []string `json:"ip,omitempty"`
+	Architecture string   `json:"architecture"`
+	OS           OSMeta   `json:"os"`
+}
+
+// OSMeta describes the operating system of the host.
+type OSMeta struct {
+	Type   string `json:"type"`
+	Kernel string `json:"kernel,omitempty"`
+}
+
+// AgentMeta describes the argo instance that collected an event.
+type AgentMeta struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Version string `json:"version"`
+}
+
+// MetaConfig holds the static fields and tags that are added to events.
+type MetaConfig struct {
+	Fields map[string]interface{} `json:"fields"`
+	Tags   []string               `json:"tags"`
+}
+
+// NewHostMeta inspects the host that argo runs on.
+func NewHostMeta() (*HostMeta, error) {
+	h := new(HostMeta)
+
+	var err error
+	h.Hostname, err = os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("could not get hostname; %s", err)
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("could not get host addresses; %s", err)
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		h.IP = append(h.IP, ipnet.IP.String())
+	}
+
+	h.Architecture = runtime.GOARCH
+	h.OS.Type = runtime.GOOS
+	h.OS.Kernel = kernelVersion()
+
+	return h, nil
+}
+
+// NewAgentMeta describes this argo instance, with the agent ID stored in the registry.
+func NewAgentMeta(reg registry.Registrar) (*AgentMeta, error) {
+	id, err := reg.AgentID()
+	if err != nil {
+		return nil, fmt.Errorf("could not get agent id; %s", err)
+	}
+
+	return &AgentMeta{ID: id, Type: "argo", Version: version()}, nil
+}
+
+// metaOf returns the tags and the encoded fields, as object members, of the events of the
+// configuration. Fields of its input are merged over the global ones.
+func (cfg *Config) metaOf() ([]string, []byte, error) {
+	metas := []MetaConfig{cfg.MetaConfig}
+	if cfg.input != nil {
+		metas = append(metas, cfg.input.MetaConfig)
+	}
+
+	var tags []string
+	seen := make(map[string]bool)
+	fields := make(map[string]interface{})
+
+	for _, meta := range metas {
+		for _, tag := range meta.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+		for field, value := range meta.Fields {
+			putField(fields, field, copyValue(value))
+		}
+	}
+
+	if len(fields) == 0 {
+		return tags, nil, nil
+	}
+
+	doc := fields
+	if !cfg.FieldsUnderRoot {
+		doc = make(map[string]interface{})
+		putField(doc, cfg.FieldsRoot, fields)
+	}
+
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not encode fields; %s", err)
+	}
+
+	// strip the braces, so that the members can be appended to the event document
+	return tags, encoded[1 : len(encoded)-1], nil
+}
+
+// validateMeta checks that fields placed at the top level do not replace the event keys.
+func (cfg *Config) validateMeta() error {
+	if cfg.FieldsRoot == "" {
+		cfg.FieldsRoot = defaultFieldsRoot
+	}
+
+	roots := []string{cfg.FieldsRoot}
+	if cfg.FieldsUnderRoot {
+		roots = roots[:0]
+		metas := []MetaConfig{cfg.MetaConfig}
+		for _, in := range cfg.Inputs {
+			metas = append(metas, in.MetaConfig)
+		}
+		for _, meta := range metas {
+			for field := range meta.Fields {
+				roots = append(roots, field)
+			}
+		}
+	}
+
+	for _, root := range roots {
+		for _, key := range reservedKeys {
+			if root == key || len(root) > len(key) && root[:len(key)+1] == key+"." {
+				return fmt.Errorf("field %q conflicts with the event key %q", root, key)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// kernelVersion is not available on this platform.
+func kernelVersion() string {
+	return ""
+}
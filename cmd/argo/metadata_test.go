@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestConfigMetaOf(t *testing.T) {
+	var tests = []struct {
+		name   string
+		config string
+		path   string
+		doc    string
+	}{
+		{
+			"no fields",
+			`{}`,
+			"/var/log/app.log",
+			`{"line":1}`,
+		}, {
+			"global fields and tags",
+			`{"fields":{"env":"prod","team.name":"core"},"tags":["a","b"]}`,
+			"/var/log/app.log",
+			`{"line":1,"tags":["a","b"],"fields":{"env":"prod","team":{"name":"core"}}}`,
+		}, {
+			"input fields override global ones",
+			`{"fields":{"env":"prod","service":"web"},"tags":["a"],
+			  "inputs":[{"paths":["/var/log/app.log"],"fields":{"service":"api"},"tags":["b","a"]},{"paths":["/var/log/*.log"],"tags":["c"]}]}`,
+			"/var/log/app.log",
+			`{"line":1,"tags":["a","b"],"fields":{"env":"prod","service":"api"}}`,
+		}, {
+			"custom root",
+			`{"fields":{"env":"prod"},"fields_root":"labels.custom"}`,
+			"/var/log/app.log",
+			`{"line":1,"labels":{"custom":{"env":"prod"}}}`,
+		}, {
+			"fields under root",
+			`{"fields":{"env":"prod","service":{"name":"api"}},"fields_under_root":true}`,
+			"/var/log/app.log",
+			`{"line":1,"env":"prod","service":{"name":"api"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := `{"host":"http://localhost:9200","paths":["./some.log"],` + strings.TrimPrefix(tt.config, "{")
+			config = strings.Replace(config, ",}", "}", 1)
+
+			cfg, err := ParseConfig(strings.NewReader(config))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e := Event{Line: 1}
+			e.Tags, e.fields, err = cfg.configOf(tt.path).metaOf()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			doc, err := json.Marshal(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var actual, expected map[string]interface{}
+			if err := json.Unmarshal(doc, &actual); err != nil {
+				t.Fatalf("invalid document %s; %s", doc, err)
+			}
+			delete(actual, "@timestamp")
+			delete(actual, "event")
+			json.Unmarshal([]byte(tt.doc), &expected)
+
+			assertEq(actual, expected, t)
+		})
+	}
+}
+
+func TestNewAgentMeta(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	agent, err := NewAgentMeta(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agent.ID) != 36 || agent.Type != "argo" || agent.Version != Version {
+		t.Fatalf("unexpected agent %#v", agent)
+	}
+
+	again, err := NewAgentMeta(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEq(again, agent, t)
+}
+
+func TestNewHostMeta(t *testing.T) {
+	host, err := NewHostMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if host.Hostname == "" {
+		t.Fatal("expected a hostname")
+	}
+	assertEq(host.OS.Type, runtime.GOOS, t)
+	assertEq(host.Architecture, runtime.GOARCH, t)
+}
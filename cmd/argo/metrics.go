@@ -0,0 +1,200 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mresvanis/argo/pkg/metrics"
+	"github.com/mresvanis/argo/pkg/registry"
+)
+
+// Metrics holds the instruments of the process, which are exposed in the Prometheus format by
+// the HTTP server. The observe methods do nothing on a nil Metrics, so that components work
+// without them.
+type Metrics struct {
+	registry *metrics.Registry
+
+	bulkDuration  *metrics.Histogram
+	ackDuration   *metrics.Histogram
+	retries       *metrics.Counter
+	registryWrite *metrics.Histogram
+}
+
+func NewMetrics() *Metrics {
+	m := new(Metrics)
+
+	m.registry = metrics.NewRegistry()
+	m.bulkDuration = m.registry.NewHistogram("argo_output_bulk_duration_seconds",
+		"Duration of the bulk requests to Elasticsearch.", metrics.DefaultBuckets, "result")
+	m.ackDuration = m.registry.NewHistogram("argo_input_batch_duration_seconds",
+		"Duration from queueing a batch to the output until it is acked.", metrics.DefaultBuckets)
+	m.retries = m.registry.NewCounter("argo_output_retries_total",
+		"Bulk requests to Elasticsearch that failed and were retried.")
+	m.registryWrite = m.registry.NewHistogram("argo_registry_write_duration_seconds",
+		"Duration of the writes to the registry.", metrics.DefaultBuckets, "op")
+
+	return m
+}
+
+func (m *Metrics) observeBulk(d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	result := "ok"
+	if err != nil {
+		result = "error"
+		m.retries.Inc()
+	}
+	m.bulkDuration.Observe(d.Seconds(), result)
+}
+
+func (m *Metrics) observeAck(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.ackDuration.Observe(d.Seconds())
+}
+
+// collectInputs registers the per source metrics, which are collected from the stats of the
+// inputs on every scrape.
+func (m *Metrics) collectInputs(h *Harvester) {
+	counter := func(name, help string, value func(s *InputStats) float64) {
+		m.registry.NewCounterFunc(name, help, []string{"source"}, func(emit metrics.Emit) {
+			for _, s := range sourceStats(h.Stats()) {
+				emit(value(&s), s.Path)
+			}
+		})
+	}
+	gauge := func(name, help string, value func(s *InputStats) float64) {
+		m.registry.NewGaugeFunc(name, help, []string{"source"}, func(emit metrics.Emit) {
+			for _, s := range sourceStats(h.Stats()) {
+				emit(value(&s), s.Path)
+			}
+		})
+	}
+
+	counter("argo_input_lines_read_total", "Lines read from the file.",
+		func(s *InputStats) float64 { return float64(s.Read) })
+	counter("argo_input_bytes_read_total", "Bytes read from the file.",
+		func(s *InputStats) float64 { return float64(s.Bytes) })
+	counter("argo_input_events_sent_total", "Events acknowledged by the output.",
+		func(s *InputStats) float64 { return float64(s.Events) })
+	counter("argo_input_events_failed_total", "Events of failed batches, which are retried.",
+		func(s *InputStats) float64 { return float64(s.Failed) })
+	counter("argo_input_errors_total", "Failed batches, setup and read errors.",
+		func(s *InputStats) float64 { return float64(s.Errors) })
+	counter("argo_input_resets_total", "Times the file was truncated or its content replaced.",
+		func(s *InputStats) float64 { return float64(s.Resets) })
+	counter("argo_input_batches_resent_total", "Batches sent again as their ack timed out.",
+		func(s *InputStats) float64 { return float64(s.Resent) })
+	counter("argo_input_long_lines_total", "Lines longer than max_line_bytes.",
+		func(s *InputStats) float64 { return float64(s.Long) })
+	counter("argo_input_events_repeated_total", "Events collapsed into an identical one by dedup.",
+		func(s *InputStats) float64 { return float64(s.Repeats) })
+	counter("argo_input_throttled_seconds_total", "Time reading paused by the rate limit.",
+		func(s *InputStats) float64 { return s.Throttled.Seconds() })
+
+	m.registry.NewCounterFunc("argo_input_events_dropped_total", "Events dropped before the output, by reason.",
+		[]string{"source", "reason"}, func(emit metrics.Emit) {
+			for _, s := range sourceStats(h.Stats()) {
+				emit(float64(s.Dropped), s.Path, "processor")
+				emit(float64(s.Filtered), s.Path, "condition")
+				emit(float64(s.Sampled), s.Path, "sampling")
+				emit(float64(s.RateLimited), s.Path, "rate_limit")
+			}
+		})
+
+	gauge("argo_input_offset_bytes", "Offset acknowledged in the registry.",
+		func(s *InputStats) float64 { return float64(s.Offset) })
+	gauge("argo_input_file_size_bytes", "Size of the file when last checked.",
+		func(s *InputStats) float64 { return float64(s.Size) })
+	gauge("argo_input_pending_events", "Events read but not acked yet.",
+		func(s *InputStats) float64 { return float64(s.Pending) })
+
+	m.registry.NewGaugeFunc("argo_open_files", "Files being harvested.", nil, func(emit metrics.Emit) {
+		emit(float64(h.Running()))
+	})
+}
+
+// collectOutput registers the metrics of the queue of the output.
+func (m *Metrics) collectOutput(out Output) {
+	m.registry.NewGaugeFunc("argo_output_queue_batches", "Batches queued for the output.", nil, func(emit metrics.Emit) {
+		emit(float64(len(out.Input())))
+	})
+	m.registry.NewGaugeFunc("argo_output_queue_capacity_batches", "Capacity of the queue of the output.", nil, func(emit metrics.Emit) {
+		emit(float64(cap(out.Input())))
+	})
+}
+
+// sourceStats merges the stats of the inputs of the same path, as a file that is harvested again
+// has an input for every time.
+func sourceStats(stats []InputStats) []InputStats {
+	merged := make([]InputStats, 0, len(stats))
+	for _, s := range stats {
+		n := len(merged)
+		if n == 0 || merged[n-1].Path != s.Path {
+			merged = append(merged, s)
+			continue
+		}
+		mergeStats(&merged[n-1], s)
+	}
+	return merged
+}
+
+// mergeStats adds the stats s of a later input of the same path to m. The counters are summed
+// and the latest gauges are kept.
+func mergeStats(m *InputStats, s InputStats) {
+	m.Read += s.Read
+	m.Bytes += s.Bytes
+	m.Events += s.Events
+	m.Failed += s.Failed
+	m.Errors += s.Errors
+	m.Resets += s.Resets
+	m.Resent += s.Resent
+	m.Long += s.Long
+	m.Dropped += s.Dropped
+	m.Filtered += s.Filtered
+	m.Sampled += s.Sampled
+	m.RateLimited += s.RateLimited
+	m.Repeats += s.Repeats
+	m.Throttled += s.Throttled
+	m.Offset = s.Offset
+	m.Size = s.Size
+	m.Pending = s.Pending
+	m.PendingSince = s.PendingSince
+	m.Inode = s.Inode
+	m.LastRead = s.LastRead
+	m.LastAck = s.LastAck
+	m.LastError = s.LastError
+}
+
+// timedRegistry records the duration of the writes to a registry.
+type timedRegistry struct {
+	registry.Registrar
+
+	metrics *Metrics
+}
+
+// instrument returns the registry with its writes timed.
+func (m *Metrics) instrument(reg registry.Registrar) registry.Registrar {
+	return &timedRegistry{Registrar: reg, metrics: m}
+}
+
+func (r *timedRegistry) observe(op string, start time.Time) {
+	r.metrics.registryWrite.Observe(time.Since(start).Seconds(), op)
+}
+
+func (r *timedRegistry) UpdateOffset(key string, offset int64) error {
+	defer r.observe("offset", time.Now())
+	return r.Registrar.UpdateOffset(key, offset)
+}
+
+func (r *timedRegistry) UpdateFingerprint(key string, fingerprint string) error {
+	defer r.observe("fingerprint", time.Now())
+	return r.Registrar.UpdateFingerprint(key, fingerprint)
+}
+
+func (r *timedRegistry) MarkComplete(key string) error {
+	defer r.observe("complete", time.Now())
+	return r.Registrar.MarkComplete(key)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsCollectInputs(t *testing.T) {
+	cfg := *testcfg
+	h := NewHarvester(&cfg, nil, nil, nil)
+	a := InputStats{Path: "/var/log/a.log", Read: 10, Bytes: 1000, Events: 8, Filtered: 2, Offset: 1000, Size: 1000}
+	mergeStats(&a, InputStats{Path: "/var/log/a.log", Read: 4, Bytes: 400, Events: 4, Offset: 400, Size: 900})
+	h.stats = map[string]InputStats{
+		"/var/log/a.log": a,
+		"/var/log/b.log": {Path: "/var/log/b.log", Read: 5, Events: 5, Failed: 3, Throttled: 1500 * time.Millisecond, Offset: 200, Size: 800},
+	}
+
+	m := NewMetrics()
+	m.collectInputs(h)
+	m.observeAck(20 * time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := m.registry.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, line := range []string{
+		`argo_input_lines_read_total{source="/var/log/a.log"} 14.0`,
+		`argo_input_bytes_read_total{source="/var/log/a.log"} 1400.0`,
+		`argo_input_events_sent_total{source="/var/log/b.log"} 5.0`,
+		`argo_input_events_failed_total{source="/var/log/b.log"} 3.0`,
+		`argo_input_events_dropped_total{reason="condition",source="/var/log/a.log"} 2.0`,
+		`argo_input_throttled_seconds_total{source="/var/log/b.log"} 1.5`,
+		`argo_input_offset_bytes{source="/var/log/a.log"} 400.0`,
+		`argo_input_file_size_bytes{source="/var/log/a.log"} 900.0`,
+		`argo_input_file_size_bytes{source="/var/log/b.log"} 800.0`,
+		`argo_open_files 0.0`,
+		`argo_input_batch_duration_seconds_bucket{le="0.025"} 1.0`,
+		`argo_input_batch_duration_seconds_count 1.0`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("expected %q in:\n%s", line, out)
+		}
+	}
+}
+
+func TestMetricsInstrument(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	m := NewMetrics()
+	reg = m.instrument(reg)
+
+	if err := reg.UpdateOffset("test.log", 42); err != nil {
+		t.Fatal(err)
+	}
+	offset, err := reg.GetOffset("test.log")
+	assertEq(err, nil, t)
+	assertEq(offset, int64(42), t)
+
+	m.observeBulk(time.Second, nil)
+
+	var buf bytes.Buffer
+	m.registry.Write(&buf)
+	for _, line := range []string{
+		`argo_registry_write_duration_seconds_count{op="offset"} 1.0`,
+		`argo_output_bulk_duration_seconds_count{result="ok"} 1.0`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Fatalf("expected %q in:\n%s", line, buf.String())
+		}
+	}
+
+	// a nil Metrics observes nothing
+	var none *Metrics
+	none.observeAck(time.Second)
+	none.observeBulk(time.Second, nil)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mresvanis/argo/pkg/logging"
+)
+
+// monitorSource is the source of the monitoring events, which subscribes to their acks.
+const monitorSource = "argo:monitoring"
+
+// MonitoringConfig configures the events with the metrics of argo itself, which are sent through
+// the output to their own index every interval.
+type MonitoringConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Interval string `json:"interval"`
+	Index    string `json:"index"`
+
+	interval time.Duration
+}
+
+func (mc *MonitoringConfig) parse() error {
+	if mc.Interval == "" {
+		mc.Interval = "30s"
+	}
+	d, err := time.ParseDuration(mc.Interval)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid monitoring interval %q", mc.Interval)
+	}
+	mc.interval = d
+
+	if mc.Index == "" {
+		mc.Index = "argo-monitoring"
+	}
+	if !validIndex(mc.Index) {
+		return fmt.Errorf("invalid monitoring index %q", mc.Index)
+	}
+
+	return nil
+}
+
+// validIndex reports whether name is a valid Elasticsearch index name.
+func validIndex(name string) bool {
+	if name == "" || name == "." || name == ".." || strings.ToLower(name) != name {
+		return false
+	}
+	if strings.IndexAny(name[:1], "-_+") == 0 {
+		return false
+	}
+	return !strings.ContainsAny(name, ` ,"*\/<>|?#:`)
+}
+
+// MonitoringMeta holds the metrics of a monitoring event, which describe either an input or the
+// process.
+type MonitoringMeta struct {
+	Type    string          `json:"type"`
+	Input   *InputMetrics   `json:"input,omitempty"`
+	Process *ProcessMetrics `json:"process,omitempty"`
+}
+
+// InputMetrics describes the progress of a source file. The counters are totals since the
+// process started, and the rates are over the last interval.
+type InputMetrics struct {
+	Path         string  `json:"path"`
+	Inode        uint64  `json:"inode,omitempty"`
+	LinesRead    uint64  `json:"lines_read"`
+	BytesRead    uint64  `json:"bytes_read"`
+	EventsSent   uint64  `json:"events_sent"`
+	EventsFailed uint64  `json:"events_failed"`
+	Errors       uint64  `json:"errors"`
+	Dropped      uint64  `json:"dropped"`
+	Repeats      uint64  `json:"repeats"`
+	LinesRate    float64 `json:"lines_per_sec"`
+	BytesRate    float64 `json:"bytes_per_sec"`
+	EventsRate   float64 `json:"events_per_sec"`
+	Offset       int64   `json:"offset"`
+	Size         int64   `json:"size"`
+	Lag          int64   `json:"lag"`
+	Pending      int     `json:"pending"`
+	LastError    string  `json:"last_error,omitempty"`
+}
+
+// ProcessMetrics describes the process and its output.
+type ProcessMetrics struct {
+	Uptime          float64 `json:"uptime_seconds"`
+	OpenFiles       int     `json:"open_files"`
+	QueueBatches    int     `json:"queue_batches"`
+	QueueCapacity   int     `json:"queue_capacity"`
+	OutputConnected bool    `json:"output_connected"`
+	OutputError     string  `json:"output_error,omitempty"`
+	Goroutines      int     `json:"goroutines"`
+	HeapAlloc       uint64  `json:"heap_alloc_bytes"`
+	Sys             uint64  `json:"sys_bytes"`
+	GCRuns          uint32  `json:"gc_runs"`
+}
+
+// Monitor periodically sends the metrics of the inputs and the process through the output, as
+// events of the monitoring index. Samples that fail to be indexed are not retried.
+type Monitor struct {
+	config *Config
+	out    Output
+	h      *Harvester
+	log    *logging.Logger
+
+	term     chan struct{}
+	stopOnce sync.Once
+
+	started time.Time
+	last    time.Time
+	prev    map[string]InputStats
+}
+
+func NewMonitor(cfg *Config, out Output, h *Harvester) *Monitor {
+	m := new(Monitor)
+
+	m.config = cfg
+	m.out = out
+	m.h = h
+	m.log = cfg.logger("monitor")
+	m.term = make(chan struct{})
+	m.started = time.Now()
+	m.last = m.started
+	m.prev = make(map[string]InputStats)
+
+	return m
+}
+
+// Start sends a sample every interval until the monitor is stopped.
+func (m *Monitor) Start() {
+	acks := m.out.Subscribe(monitorSource)
+	defer m.out.Unsubscribe(monitorSource)
+
+	ticker := time.NewTicker(m.config.Monitoring.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.term:
+			return
+		case now := <-ticker.C:
+			if !m.send(m.sample(now), acks) {
+				return
+			}
+		}
+	}
+}
+
+func (m *Monitor) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.term)
+	})
+}
+
+// send queues the events to the output and waits for their ack. It returns false if the monitor
+// was stopped meanwhile.
+func (m *Monitor) send(events []Event, acks <-chan Ack) bool {
+	select {
+	case m.out.Input() <- events:
+	case <-m.term:
+		return false
+	}
+
+	select {
+	case ack, ok := <-acks:
+		if !ok {
+			return false
+		}
+		if ack.HasError() {
+			m.log.Warn("could not index monitoring events", "events", len(events))
+		}
+	case <-m.term:
+		return false
+	}
+
+	return true
+}
+
+// sample returns the monitoring events at now: one for every source that is being harvested or
+// progressed since the last sample, and one for the process.
+func (m *Monitor) sample(now time.Time) []Event {
+	elapsed := now.Sub(m.last).Seconds()
+	m.last = now
+
+	active := make(map[string]bool)
+	for _, s := range m.h.Active() {
+		active[s.Path] = true
+	}
+
+	var events []Event
+	for _, s := range sourceStats(m.h.Stats()) {
+		prev := m.prev[s.Path]
+		m.prev[s.Path] = s
+		if !active[s.Path] && s.Read == prev.Read && s.Events == prev.Events && s.Errors == prev.Errors {
+			continue
+		}
+
+		im := &InputMetrics{
+			Path:         s.Path,
+			Inode:        s.Inode,
+			LinesRead:    s.Read,
+			BytesRead:    s.Bytes,
+			EventsSent:   s.Events,
+			EventsFailed: s.Failed,
+			Errors:       s.Errors,
+			Dropped:      s.Dropped + s.Filtered + s.Sampled + s.RateLimited,
+			Repeats:      s.Repeats,
+			LinesRate:    rate(s.Read, prev.Read, elapsed),
+			BytesRate:    rate(s.Bytes, prev.Bytes, elapsed),
+			EventsRate:   rate(s.Events, prev.Events, elapsed),
+			Offset:       s.Offset,
+			Size:         s.Size,
+			Pending:      s.Pending,
+			LastError:    s.LastError,
+		}
+		if s.Size > s.Offset {
+			im.Lag = s.Size - s.Offset
+		}
+		events = append(events, m.event(now, &MonitoringMeta{Type: "input", Input: im}))
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	health := m.out.Health()
+
+	events = append(events, m.event(now, &MonitoringMeta{Type: "process", Process: &ProcessMetrics{
+		Uptime:          now.Sub(m.started).Seconds(),
+		OpenFiles:       m.h.Running(),
+		QueueBatches:    len(m.out.Input()),
+		QueueCapacity:   cap(m.out.Input()),
+		OutputConnected: health.Connected,
+		OutputError:     health.LastError,
+		Goroutines:      runtime.NumGoroutine(),
+		HeapAlloc:       mem.HeapAlloc,
+		Sys:             mem.Sys,
+		GCRuns:          mem.NumGC,
+	}}))
+
+	return events
+}
+
+func (m *Monitor) event(now time.Time, meta *MonitoringMeta) Event {
+	source := monitorSource
+
+	e := Event{}
+	e.Timestamp = now
+	e.Source = &source
+	e.Meta.Ingested = now
+	e.Host = m.config.host
+	e.Agent = m.config.agent
+	e.Monitoring = meta
+	e.index = m.config.Monitoring.Index
+
+	return e
+}
+
+// rate returns the increase of a counter per second; counters that restarted count from zero.
+func rate(cur, prev uint64, seconds float64) float64 {
+	if seconds <= 0 {
+		return 0
+	}
+	if cur < prev {
+		prev = 0
+	}
+	return float64(cur-prev) / seconds
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitorSample(t *testing.T) {
+	cfg := *testcfg
+	cfg.Monitoring = MonitoringConfig{Enabled: true}
+	if err := cfg.Monitoring.parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := newTestOutput()
+	h := NewHarvester(&cfg, out, nil, nil)
+	h.inputs["a.log"] = &statsInput{InputStats{Path: "a.log", Read: 100, Bytes: 4000, Events: 90, Offset: 3000, Size: 4000}}
+	h.stats = map[string]InputStats{"old.log": {Path: "old.log", Read: 10, Events: 10}}
+
+	m := NewMonitor(&cfg, out, h)
+	start := m.last
+
+	events := m.sample(start.Add(10 * time.Second))
+	if len(events) != 3 {
+		t.Fatalf("expected 2 input events and a process event, got %d", len(events))
+	}
+
+	a := events[0].Monitoring.Input
+	assertEq(a.Path, "a.log", t)
+	assertEq(a.LinesRate, 10.0, t)
+	assertEq(a.EventsRate, 9.0, t)
+	assertEq(a.Lag, int64(1000), t)
+	assertEq(events[2].Monitoring.Type, "process", t)
+	assertEq(events[2].Monitoring.Process.OpenFiles, 1, t)
+	for _, e := range events {
+		assertEq(*e.Source, monitorSource, t)
+		assertEq(e.index, "argo-monitoring", t)
+	}
+
+	// finished inputs that did not progress are not sampled again
+	h.inputs["a.log"] = &statsInput{InputStats{Path: "a.log", Read: 150, Bytes: 6000, Events: 150, Offset: 6000, Size: 6000}}
+	events = m.sample(start.Add(15 * time.Second))
+	if len(events) != 2 {
+		t.Fatalf("expected an input event and a process event, got %d", len(events))
+	}
+	assertEq(events[0].Monitoring.Input.EventsRate, 12.0, t)
+	assertEq(events[0].Monitoring.Input.Lag, int64(0), t)
+}
+
+func TestMonitorSend(t *testing.T) {
+	cfg := *testcfg
+	cfg.Monitoring = MonitoringConfig{Enabled: true, Interval: "10ms", Index: "argo-mon"}
+	if err := cfg.Monitoring.parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := newTestOutput()
+	m := NewMonitor(&cfg, out, NewHarvester(&cfg, out, nil, nil))
+
+	done := async(m.Start)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case events := <-out.input:
+			assertEq(events[0].Monitoring.Type, "process", t)
+
+			buf, err := prepareBulkPayload(events)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(buf.String(), `{"index":{"_index":"argo-mon","_id":"`) ||
+				!bytes.Contains(buf.Bytes(), []byte(`"monitoring":{"type":"process","process":{`)) {
+				t.Fatalf("unexpected bulk payload %s", buf.String())
+			}
+			out.ack(events)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no monitoring events were sent")
+		}
+	}
+
+	// stops while waiting for the output
+	m.Stop()
+	waitClosed(done, "monitor did not stop", t)
+}
+
+func TestMonitoringConfig(t *testing.T) {
+	for _, index := range []string{"argo-monitoring", ".argo", "argo_mon.2019"} {
+		mc := MonitoringConfig{Index: index}
+		if err := mc.parse(); err != nil {
+			t.Fatalf("expected index %q to be valid, got %s", index, err)
+		}
+	}
+	for _, index := range []string{"Argo", "-argo", "argo mon", "argo,mon", "argo:mon", ".."} {
+		mc := MonitoringConfig{Index: index}
+		if err := mc.parse(); err == nil {
+			t.Fatalf("expected index %q to be invalid", index)
+		}
+	}
+
+	mc := MonitoringConfig{Interval: "0s"}
+	if err := mc.parse(); err == nil || err.Error() != `invalid monitoring interval "0s"` {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Ways that the lines matching the pattern of a multiline group are joined.
+const (
+	multilineAfter  = "after"
+	multilineBefore = "before"
+)
+
+// MultilineConfig joins consecutive lines into a single event, such as the lines of a pretty
+// printed JSON document or of a stack trace. A line continues a group if it matches Pattern or,
+// with Negate, if it does not. With Match after, continuation lines are appended to the line
+// before them; with before, they are prepended to the line after them.
+type MultilineConfig struct {
+	Pattern  string `json:"pattern"`
+	Negate   bool   `json:"negate"`
+	Match    string `json:"match"`
+	MaxLines int    `json:"max_lines"`
+
+	// Timeout is how long a group waits for its next line before it is sent as is.
+	Timeout string `json:"timeout"`
+
+	pattern *regexp.Regexp
+	timeout time.Duration
+}
+
+func (mc *MultilineConfig) parse() error {
+	if mc.Pattern == "" {
+		return nil
+	}
+
+	var err error
+	mc.pattern, err = regexp.Compile(mc.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid multiline pattern; %s", err)
+	}
+
+	switch mc.Match {
+	case "":
+		mc.Match = multilineAfter
+	case multilineAfter, multilineBefore:
+	default:
+		return fmt.Errorf("invalid multiline match %q, expected %q or %q", mc.Match, multilineAfter, multilineBefore)
+	}
+
+	if mc.MaxLines < 0 {
+		return fmt.Errorf("invalid multiline max_lines %d", mc.MaxLines)
+	}
+	if mc.MaxLines == 0 {
+		mc.MaxLines = 500
+	}
+
+	if mc.Timeout == "" {
+		mc.Timeout = "5s"
+	}
+	mc.timeout, err = time.ParseDuration(mc.Timeout)
+	if err != nil || mc.timeout <= 0 {
+		return fmt.Errorf("invalid multiline timeout %q", mc.Timeout)
+	}
+
+	return nil
+}
+
+// lineGroup is a group of consecutive lines, joined with newlines.
+type lineGroup struct {
+	text      string
+	bytes     int // bytes read, including the line endings
+	lines     uint64
+	truncated bool
+}
+
+// multiline groups the lines of an input. The text of a group is limited to maxBytes, past which
+// its lines are read but not kept and the group is truncated.
+type multiline struct {
+	config   *MultilineConfig
+	maxBytes int
+
+	group lineGroup
+	text  []byte
+	last  time.Time
+}
+
+// newMultiline returns the multiline grouping of the configuration, or nil if it has no pattern.
+func newMultiline(cfg MultilineConfig, maxBytes int64) *multiline {
+	if cfg.pattern == nil {
+		return nil
+	}
+
+	m := new(multiline)
+	m.config = &cfg
+	m.maxBytes = int(maxBytes)
+
+	return m
+}
+
+// add adds a line to the current group and returns the groups that it completes: in after mode,
+// a line that does not continue the group completes the previous one, and in both modes a line
+// completes its own group when it does not continue it in before mode or reaches max_lines.
+func (m *multiline) add(text string, bytesread int, truncated bool, now time.Time) []lineGroup {
+	continues := m.config.pattern.MatchString(text) != m.config.Negate
+
+	var done []lineGroup
+	if m.config.Match == multilineAfter && !continues {
+		if g, ok := m.flush(); ok {
+			done = append(done, g)
+		}
+	}
+
+	if m.group.lines > 0 {
+		m.text = append(m.text, '\n')
+	}
+	if room := m.maxBytes - len(m.text); len(text) > room {
+		if room < 0 {
+			room = 0
+		}
+		text = text[:room]
+		truncated = true
+	}
+	m.text = append(m.text, text...)
+	m.group.bytes += bytesread
+	m.group.lines++
+	m.group.truncated = m.group.truncated || truncated
+	m.last = now
+
+	if m.config.Match == multilineBefore && !continues || m.group.lines >= uint64(m.config.MaxLines) {
+		g, _ := m.flush()
+		done = append(done, g)
+	}
+
+	return done
+}
+
+// flush returns the current group, if it has any line, and starts a new one.
+func (m *multiline) flush() (lineGroup, bool) {
+	if m.group.lines == 0 {
+		return lineGroup{}, false
+	}
+
+	g := m.group
+	g.text = string(m.text)
+
+	m.group = lineGroup{}
+	m.text = m.text[:0]
+
+	return g, true
+}
+
+// expired returns the current group if it has waited for its next line longer than the timeout.
+func (m *multiline) expired(now time.Time) (lineGroup, bool) {
+	if m.group.lines == 0 || now.Sub(m.last) < m.config.timeout {
+		return lineGroup{}, false
+	}
+	return m.flush()
+}
+
+// deadline returns when the current group expires, if it has any line.
+func (m *multiline) deadline() (time.Time, bool) {
+	if m.group.lines == 0 {
+		return time.Time{}, false
+	}
+	return m.last.Add(m.config.timeout), true
+}
+
+// reset drops the current group.
+func (m *multiline) reset() {
+	m.group = lineGroup{}
+	m.text = m.text[:0]
+}
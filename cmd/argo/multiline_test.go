@@ -0,0 +1,150 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMultiline(t *testing.T) {
+	tests := []struct {
+		name   string
+		config MultilineConfig
+		lines  []string
+		exp    []string
+		rest   string
+	}{
+		{
+			name:   "after",
+			config: MultilineConfig{Pattern: `^\s`},
+			lines:  []string{"panic: boom", "  at main.go:10", "  at main.go:20", "next", "last"},
+			exp:    []string{"panic: boom\n  at main.go:10\n  at main.go:20", "next"},
+			rest:   "last",
+		},
+		{
+			name:   "negate",
+			config: MultilineConfig{Pattern: `^\{`, Negate: true},
+			lines:  []string{"{", `  "a": 1`, "}", "{", "}"},
+			exp:    []string{"{\n  \"a\": 1\n}"},
+			rest:   "{\n}",
+		},
+		{
+			name:   "before",
+			config: MultilineConfig{Pattern: `\\$`, Match: "before"},
+			lines:  []string{`one \`, `two \`, "three", "four", `five \`},
+			exp:    []string{"one \\\ntwo \\\nthree", "four"},
+			rest:   `five \`,
+		},
+		{
+			name:   "max lines",
+			config: MultilineConfig{Pattern: `^\s`, MaxLines: 2},
+			lines:  []string{"a", " b", " c", "d"},
+			exp:    []string{"a\n b", " c"},
+			rest:   "d",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.parse(); err != nil {
+				t.Fatal(err)
+			}
+			m := newMultiline(tt.config, 1024)
+
+			var groups []string
+			for _, line := range tt.lines {
+				for _, g := range m.add(line, len(line)+1, false, time.Now()) {
+					groups = append(groups, g.text)
+				}
+			}
+			assertEq(groups, tt.exp, t)
+
+			g, _ := m.flush()
+			assertEq(g.text, tt.rest, t)
+		})
+	}
+}
+
+func TestMultilineLimits(t *testing.T) {
+	cfg := MultilineConfig{Pattern: `^\s`, Timeout: "1s"}
+	if err := cfg.parse(); err != nil {
+		t.Fatal(err)
+	}
+	m := newMultiline(cfg, 10)
+
+	start := time.Now()
+	assertEq(len(m.add("abcdef", 7, false, start)), 0, t)
+	assertEq(len(m.add(" ghijkl", 8, false, start)), 0, t)
+
+	if _, ok := m.expired(start.Add(999 * time.Millisecond)); ok {
+		t.Fatal("group expired before its timeout")
+	}
+	g, ok := m.expired(start.Add(time.Second))
+	if !ok {
+		t.Fatal("group did not expire")
+	}
+	assertEq(g, lineGroup{text: "abcdef\n gh", bytes: 15, lines: 2, truncated: true}, t)
+
+	if _, ok := m.deadline(); ok {
+		t.Fatal("expected no deadline without a group")
+	}
+}
+
+func TestMultilineConfig(t *testing.T) {
+	for _, tt := range []struct {
+		config MultilineConfig
+		err    string
+	}{
+		{MultilineConfig{Pattern: "("}, "invalid multiline pattern; error parsing regexp: missing closing ): `(`"},
+		{MultilineConfig{Pattern: "^a", Match: "around"}, `invalid multiline match "around", expected "after" or "before"`},
+		{MultilineConfig{Pattern: "^a", Timeout: "0s"}, `invalid multiline timeout "0s"`},
+	} {
+		err := tt.config.parse()
+		if err == nil || err.Error() != tt.err {
+			t.Fatalf("expected error %q, got %v", tt.err, err)
+		}
+	}
+}
+
+func TestFileInputMultiline(t *testing.T) {
+	content := "{\n" +
+		`  "level": "error",` + "\n" +
+		`  "msg": "boom"` + "\n" +
+		"}\n" +
+		"panic: boom\n" +
+		"  at main.go:10\n" +
+		`{"level":"info"}` + "\n"
+
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	f, err := ioutil.TempFile("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	f.WriteString(content)
+	f.Close()
+
+	cfg := *testcfg
+	cfg.Multiline = MultilineConfig{Pattern: `^(\{|panic)`, Negate: true}
+	if err := cfg.Multiline.parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	events, input := harvestOnce(&cfg, path, reg, t)
+
+	assertEq(len(events), 3, t)
+	assertEq(events[0].Text, map[string]interface{}{"level": "error", "msg": "boom"}, t)
+	assertEq(events[1].Text, map[string]interface{}{"message": "panic: boom\n  at main.go:10"}, t)
+	assertEq(events[2].Text, map[string]interface{}{"level": "info"}, t)
+	assertEq([]uint64{events[0].Line, events[1].Line, events[2].Line}, []uint64{1, 5, 7}, t)
+	assertEq(events[1].Offset, int64(len("{\n  \"level\": \"error\",\n  \"msg\": \"boom\"\n}\n")), t)
+
+	assertEq(input.Stats().Read, uint64(7), t)
+
+	offset, _ := reg.GetOffset(path)
+	assertEq(offset, int64(len(content)), t)
+}
@@ -1,15 +1,19 @@
 package main
 
 import (
-	"log"
-	"os"
 	"sync"
 	"time"
+
+	"github.com/mresvanis/argo/pkg/logging"
 )
 
 const (
 	indexName     = "argo"
 	retryInterval = 5
+
+	// ackBufferSize is the number of acks kept for a subscriber that is not waiting for them,
+	// such as the acks of batches that were resent. Further acks wait for the subscriber.
+	ackBufferSize = 8
 )
 
 // Output accepts event batches from inputs.
@@ -21,38 +25,78 @@ type Output interface {
 	// Start reads events from the input channel.
 	Start()
 
-	// Stop terminates the input loop.
+	// Stop terminates the input loop, once the queued batches are dispatched and acked. It
+	// returns when the loop has terminated.
 	Stop()
 
+	// Abort gives up on the queued batches and the one being retried, so that a stop does not
+	// wait for the host any longer.
+	Abort()
+
 	// Subscribe returns the channel to listen to acks to with the specific Event source.
 	Subscribe(string) <-chan Ack
 
 	// Unsubscribe removes the specified subscriber.
 	Unsubscribe(string)
+
+	// Health returns the state of the connection to the host.
+	Health() OutputHealth
+
+	// Reload applies the output settings of the configuration. Batches that are queued or being
+	// retried are sent with the new settings.
+	Reload(*Config) error
+}
+
+// OutputHealth describes the state of an output.
+type OutputHealth struct {
+	Running   bool      // the output loop is accepting batches
+	Connected bool      // the last request to the host succeeded
+	LastAck   time.Time // time of the last successful request
+	LastError string
 }
 
 type EsOutput struct {
 	sync.Mutex
 
-	config *Config
-	log    *log.Logger
-	input  chan []Event
-	term   chan struct{}
-	es     *Elasticsearch
+	config  *Config
+	log     *logging.Logger
+	metrics *Metrics
+	input   chan []Event
+	es      *Elasticsearch
+
+	term      chan struct{}
+	stopOnce  sync.Once
+	abort     chan struct{}
+	abortOnce sync.Once
+	done      chan struct{}
+
+	// reloaded wakes a retry that waits for the next attempt, once the settings are reloaded
+	reloaded chan struct{}
 
-	subscribers map[string]chan Ack
+	subscribers map[string]*subscriber
+	health      OutputHealth
+}
+
+// subscriber receives the acks of a source, until it unsubscribes and done is closed.
+type subscriber struct {
+	acks chan Ack
+	done chan struct{}
 }
 
 func NewEsOutput(cfg *Config) Output {
 	eso := new(EsOutput)
 
 	eso.config = cfg
+	eso.metrics = cfg.metrics
 	eso.input = make(chan []Event, cfg.BufferSize)
 	eso.term = make(chan struct{})
-	eso.log = log.New(os.Stderr, "[out] ", log.LstdFlags)
-	eso.subscribers = make(map[string]chan Ack)
+	eso.abort = make(chan struct{})
+	eso.done = make(chan struct{})
+	eso.log = cfg.logger("out").With("host", redactURL(cfg.Host))
+	eso.subscribers = make(map[string]*subscriber)
+	eso.reloaded = make(chan struct{}, 1)
 
-	eso.es = NewElasticsearchDispatcher([]string{cfg.Host})
+	eso.es = NewElasticsearchDispatcher([]string{cfg.Host}, cfg.logger("es"))
 
 	return eso
 }
@@ -62,71 +106,200 @@ func (eso *EsOutput) Input() chan<- []Event {
 }
 
 func (eso *EsOutput) Start() {
+	defer close(eso.done)
+
 	err := eso.es.Setup()
 	if err != nil {
-		eso.log.Printf("could not setup es client; %s", err.Error())
+		eso.logger().Error("could not set up es client", "error", err)
+		eso.updateHealth(func(h *OutputHealth) { h.LastError = err.Error() })
 		return
 	}
 
+	// no request has failed yet
+	eso.updateHealth(func(h *OutputHealth) {
+		h.Running = true
+		h.Connected = true
+	})
+	defer eso.updateHealth(func(h *OutputHealth) { h.Running = false })
+
 	for {
 		select {
 		case <-eso.term:
-			eso.input = nil
+			eso.drain()
 			return
 
-		case batch, ok := <-eso.input:
-			if !ok {
-				eso.input = nil
-				// TODO: error handling
+		case batch := <-eso.input:
+			if !eso.send(batch) {
 				return
 			}
+		}
+	}
+}
 
-			for {
-				ack, err := eso.es.Send(batch)
-				if err == nil {
-					eso.notifySubscribers(ack)
-					break
-				}
+// drain sends the queued batches, until none is left or the output is aborted.
+func (eso *EsOutput) drain() {
+	eso.logger().Info("sending queued batches", "batches", len(eso.input))
 
-				eso.log.Printf(err.Error())
-				time.Sleep(retryInterval * time.Second)
+	for {
+		select {
+		case batch := <-eso.input:
+			if !eso.send(batch) {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// send dispatches the batch and notifies its subscriber, retrying until the request succeeds. It
+// returns false if the output is aborted meanwhile.
+func (eso *EsOutput) send(batch []Event) bool {
+	for {
+		start := time.Now()
+		ack, err := eso.dispatcher().Send(batch)
+		eso.metrics.observeBulk(time.Since(start), err)
+		eso.updateHealth(func(h *OutputHealth) {
+			h.Connected = err == nil && !ack.HasError()
+			switch {
+			case err != nil:
+				h.LastError = err.Error()
+			case ack.HasError():
+				h.LastError = "bulk request failed"
+			default:
+				h.LastAck = time.Now()
+				h.LastError = ""
 			}
+		})
+		if err == nil {
+			eso.notifySubscribers(ack)
+			return true
 		}
+
+		eso.logger().Error("bulk request failed, retrying", "events", len(batch), "retry_in", retryInterval*time.Second, "error", err)
+		select {
+		case <-time.After(retryInterval * time.Second):
+		case <-eso.reloaded:
+		case <-eso.abort:
+			eso.logger().Warn("abandoned batches", "batches", len(eso.input)+1)
+			return false
+		}
+	}
+}
+
+// Reload sets up a client for the host of the configuration and replaces the current one, unless
+// the host is unchanged.
+func (eso *EsOutput) Reload(cfg *Config) error {
+	eso.Lock()
+	host := eso.config.Host
+	eso.Unlock()
+	if cfg.Host == host {
+		return nil
 	}
+
+	es := NewElasticsearchDispatcher([]string{cfg.Host}, cfg.logger("es"))
+	err := es.Setup()
+	if err != nil {
+		return err
+	}
+
+	log := cfg.logger("out").With("host", redactURL(cfg.Host))
+
+	eso.Lock()
+	eso.config = cfg
+	eso.es = es
+	eso.log = log
+	eso.Unlock()
+
+	log.Info("reloaded", "previous", host)
+	select {
+	case eso.reloaded <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (eso *EsOutput) dispatcher() *Elasticsearch {
+	eso.Lock()
+	defer eso.Unlock()
+
+	return eso.es
+}
+
+func (eso *EsOutput) logger() *logging.Logger {
+	eso.Lock()
+	defer eso.Unlock()
+
+	return eso.log
 }
 
 func (eso *EsOutput) Stop() {
-	eso.term <- struct{}{}
-	eso.log.Printf("stopped for host %s", eso.config.Host)
+	eso.stopOnce.Do(func() {
+		close(eso.term)
+	})
+	<-eso.done
+	eso.logger().Info("stopped")
+}
+
+func (eso *EsOutput) Abort() {
+	eso.abortOnce.Do(func() {
+		close(eso.abort)
+	})
 }
 
 func (eso *EsOutput) Subscribe(subID string) <-chan Ack {
-	ackCh := make(chan Ack)
+	sub := &subscriber{acks: make(chan Ack, ackBufferSize), done: make(chan struct{})}
 
 	eso.Lock()
-	eso.subscribers[subID] = ackCh
+	if prev, ok := eso.subscribers[subID]; ok {
+		close(prev.done)
+	}
+	eso.subscribers[subID] = sub
 	eso.Unlock()
 
-	return ackCh
+	return sub.acks
 }
 
 func (eso *EsOutput) Unsubscribe(subID string) {
 	eso.Lock()
-	delete(eso.subscribers, subID)
+	if sub, ok := eso.subscribers[subID]; ok {
+		close(sub.done)
+		delete(eso.subscribers, subID)
+	}
 	eso.Unlock()
 }
 
+func (eso *EsOutput) Health() OutputHealth {
+	eso.Lock()
+	defer eso.Unlock()
+
+	return eso.health
+}
+
+func (eso *EsOutput) updateHealth(update func(*OutputHealth)) {
+	eso.Lock()
+	update(&eso.health)
+	eso.Unlock()
+}
+
+// notifySubscribers delivers the ack to the subscriber of the source of its events. Acks are
+// buffered, so that they are delivered even if the subscriber is not waiting yet, and once the
+// buffer is full the output waits for the subscriber. The ack of a source without a subscriber,
+// whose input has terminated, is orphaned.
 func (eso *EsOutput) notifySubscribers(ack Ack) {
 	event := ack.Event()
 
 	eso.Lock()
-	ch, exists := eso.subscribers[*event.Source]
+	sub, exists := eso.subscribers[*event.Source]
+	eso.Unlock()
+
 	if exists {
 		select {
-		case ch <- ack:
-		default:
-			eso.log.Printf("did not ack events for %s at offset %d", *event.Source, event.Offset)
+		case sub.acks <- ack:
+			return
+		case <-sub.done:
+		case <-eso.abort:
 		}
 	}
-	eso.Unlock()
+	eso.logger().Warn("orphaned ack", "source", *event.Source, "batch", event.batch, "offset", event.Offset)
 }
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestEsOutputInput(t *testing.T) {
@@ -14,3 +18,97 @@ func TestEsOutputInput(t *testing.T) {
 	assertEq(len(input), 1, t)
 	assertEq(cap(input), 2, t)
 }
+
+func TestEsOutputStop(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	cfg := *testcfg
+	cfg.Host = server.URL
+	out := NewEsOutput(&cfg)
+
+	// the queued batches are sent before the output stops
+	for _, source := range []string{"a.log", "b.log"} {
+		source := source
+		out.Input() <- []Event{{Source: &source, Text: map[string]interface{}{"test": "field"}}}
+	}
+
+	go out.Start()
+	waitClosed(async(out.Stop), "output did not stop", t)
+	assertEq(atomic.LoadInt32(&requests), int32(2), t)
+	assertEq(out.Health().Running, false, t)
+}
+
+func TestEsOutputAbort(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	cfg := *testcfg
+	cfg.Host = server.URL
+	out := NewEsOutput(&cfg)
+
+	source := "a.log"
+	out.Input() <- []Event{{Source: &source, Text: map[string]interface{}{"test": "field"}}}
+
+	go out.Start()
+	stopped := async(out.Stop)
+
+	// the batch is retried while the host is unreachable
+	select {
+	case <-stopped:
+		t.Fatal("output stopped before sending the queued batch")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	out.Abort()
+	waitClosed(stopped, "output did not stop once aborted", t)
+}
+
+func TestEsOutputNotifySubscribers(t *testing.T) {
+	cfg := *testcfg
+	out := NewEsOutput(&cfg).(*EsOutput)
+
+	source, other := "a.log", "b.log"
+	acks := out.Subscribe(source)
+
+	// acks are delivered even if the subscriber is not waiting
+	for i := 0; i < ackBufferSize; i++ {
+		out.notifySubscribers(NewAck(Event{Source: &source, batch: uint64(i + 1)}, false))
+	}
+	assertEq(len(acks), ackBufferSize, t)
+
+	// once too many pend, the output waits for the subscriber instead of dropping the ack
+	notified := async(func() {
+		out.notifySubscribers(NewAck(Event{Source: &source, batch: ackBufferSize + 1}, false))
+	})
+	select {
+	case <-notified:
+		t.Fatal("ack was not kept for the subscriber")
+	case <-time.After(100 * time.Millisecond):
+	}
+	for i := 0; i < ackBufferSize+1; i++ {
+		assertEq((<-acks).Event().batch, uint64(i+1), t)
+	}
+	<-notified
+
+	// acks of sources without a subscriber are orphaned
+	orphaned := async(func() { out.notifySubscribers(NewAck(Event{Source: &other}, false)) })
+	waitClosed(orphaned, "orphaned ack blocked the output", t)
+
+	// a subscriber that unsubscribes, or an abort, releases an output that waits for it
+	for _, release := range []func(){func() { out.Unsubscribe(source) }, out.Abort} {
+		out.Subscribe(source)
+		for i := 0; i < ackBufferSize; i++ {
+			out.notifySubscribers(NewAck(Event{Source: &source}, false))
+		}
+
+		pending := async(func() { out.notifySubscribers(NewAck(Event{Source: &source}, false)) })
+		release()
+		waitClosed(pending, "pending ack blocked the output", t)
+	}
+}
@@ -0,0 +1,629 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mresvanis/argo/pkg/expr"
+)
+
+// Processor transforms the events of an input before they are dispatched to the output.
+type Processor interface {
+	// Process modifies the event in place and returns false if the event should be dropped.
+	Process(e *Event) (bool, error)
+}
+
+// ProcessorFactory creates a Processor from its JSON configuration.
+type ProcessorFactory func(args json.RawMessage) (Processor, error)
+
+// ProcessorConfig configures a single processor, as an object with its name as the only key and
+// its arguments as the value, e.g. {"drop_fields": {"fields": ["password"]}}.
+type ProcessorConfig map[string]json.RawMessage
+
+var processorFactories = map[string]ProcessorFactory{
+	"add_fields":      newAddFields,
+	"convert":         newConvert,
+	"copy_fields":     newCopyFields,
+	"drop_event":      newDropEvent,
+	"drop_fields":     newDropFields,
+	"flatten":         newFlatten,
+	"lowercase":       newLowercase,
+	"mask":            newMask,
+	"rename":          newRename,
+	"truncate_fields": newTruncateFields,
+	"unflatten":       newUnflatten,
+}
+
+// RegisterProcessor makes a processor available to the configuration under the specified name,
+// replacing any processor registered with the same name.
+func RegisterProcessor(name string, factory ProcessorFactory) {
+	processorFactories[name] = factory
+}
+
+// Processors is a chain of processors applied in order. It stops at the first processor that
+// drops the event, while one that fails is recorded and the chain carries on.
+type Processors []Processor
+
+// NewProcessors creates the chain of processors described by the configuration.
+func NewProcessors(configs []ProcessorConfig) (Processors, error) {
+	ps := make(Processors, 0, len(configs))
+
+	for i, pc := range configs {
+		if len(pc) != 1 {
+			return nil, fmt.Errorf("processor %d must have exactly one name, found %d", i, len(pc))
+		}
+
+		for name, args := range pc {
+			factory, ok := processorFactories[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown processor %q", name)
+			}
+
+			p, err := factory(args)
+			if err != nil {
+				return nil, fmt.Errorf("processor %s; %s", name, err)
+			}
+			ps = append(ps, named{name, p})
+		}
+	}
+
+	return ps, nil
+}
+
+// Process applies the processors to the event in order. A processor that fails does not stop
+// the chain, so that the processors after it, such as a mask, still apply, and the errors of all
+// are returned.
+func (ps Processors) Process(e *Event) (bool, error) {
+	if e.Text == nil {
+		e.Text = make(map[string]interface{})
+	}
+
+	var errs error
+	for _, p := range ps {
+		keep, err := p.Process(e)
+		if err != nil {
+			if errs == nil {
+				errs = err
+			} else {
+				errs = fmt.Errorf("%s; %s", errs, err)
+			}
+		}
+		if !keep {
+			return false, errs
+		}
+	}
+	return true, errs
+}
+
+// named prefixes the errors of a processor with its configured name.
+type named struct {
+	name string
+	Processor
+}
+
+func (n named) Process(e *Event) (bool, error) {
+	keep, err := n.Processor.Process(e)
+	if err != nil {
+		return keep, fmt.Errorf("%s; %s", n.name, err)
+	}
+	return keep, nil
+}
+
+// decodeArgs strictly decodes the arguments of a processor into v.
+func decodeArgs(args json.RawMessage, v interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(args))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// fieldMapping maps a field to another, e.g. to rename or copy it.
+type fieldMapping struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func decodeMappings(args json.RawMessage) ([]fieldMapping, error) {
+	var cfg struct {
+		Fields []fieldMapping `json:"fields"`
+	}
+	err := decodeArgs(args, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Fields) == 0 {
+		return nil, fmt.Errorf("no fields defined")
+	}
+	for _, m := range cfg.Fields {
+		if m.From == "" || m.To == "" {
+			return nil, fmt.Errorf("fields need both from and to")
+		}
+	}
+	return cfg.Fields, nil
+}
+
+func decodeFields(args json.RawMessage, v interface{}, fields *[]string) error {
+	err := decodeArgs(args, v)
+	if err != nil {
+		return err
+	}
+
+	if len(*fields) == 0 {
+		return fmt.Errorf("no fields defined")
+	}
+	return nil
+}
+
+// rename moves the value of each field to another; missing fields are ignored.
+type rename []fieldMapping
+
+func newRename(args json.RawMessage) (Processor, error) {
+	fields, err := decodeMappings(args)
+	return rename(fields), err
+}
+
+func (r rename) Process(e *Event) (bool, error) {
+	for _, m := range r {
+		v, ok := lookupField(e.Text, m.From)
+		if !ok {
+			continue
+		}
+		deleteField(e.Text, m.From)
+		putField(e.Text, m.To, v)
+	}
+	return true, nil
+}
+
+// copyFields copies the value of each field to another; missing fields are ignored.
+type copyFields []fieldMapping
+
+func newCopyFields(args json.RawMessage) (Processor, error) {
+	fields, err := decodeMappings(args)
+	return copyFields(fields), err
+}
+
+func (c copyFields) Process(e *Event) (bool, error) {
+	for _, m := range c {
+		v, ok := lookupField(e.Text, m.From)
+		if !ok {
+			continue
+		}
+		putField(e.Text, m.To, copyValue(v))
+	}
+	return true, nil
+}
+
+// copyValue returns a deep copy of a decoded JSON value, so that copies can be modified
+// independently.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = copyValue(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, val := range v {
+			s[i] = copyValue(val)
+		}
+		return s
+	}
+	return v
+}
+
+// dropFields removes fields from the event.
+type dropFields []string
+
+func newDropFields(args json.RawMessage) (Processor, error) {
+	var cfg struct {
+		Fields []string `json:"fields"`
+	}
+	err := decodeFields(args, &cfg, &cfg.Fields)
+	return dropFields(cfg.Fields), err
+}
+
+func (d dropFields) Process(e *Event) (bool, error) {
+	for _, field := range d {
+		deleteField(e.Text, field)
+	}
+	return true, nil
+}
+
+// addFields sets fields to constant values, replacing existing ones.
+type addFields map[string]interface{}
+
+func newAddFields(args json.RawMessage) (Processor, error) {
+	var cfg struct {
+		Fields map[string]interface{} `json:"fields"`
+	}
+	err := decodeArgs(args, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Fields) == 0 {
+		return nil, fmt.Errorf("no fields defined")
+	}
+	return addFields(cfg.Fields), nil
+}
+
+func (a addFields) Process(e *Event) (bool, error) {
+	// sort the fields, so that overlapping paths are applied in a stable order
+	fields := make([]string, 0, len(a))
+	for field := range a {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		putField(e.Text, field, copyValue(a[field]))
+	}
+	return true, nil
+}
+
+// Types supported by the convert processor.
+const (
+	typeString  = "string"
+	typeInteger = "integer"
+	typeFloat   = "float"
+	typeBoolean = "boolean"
+)
+
+type conversion struct {
+	Field string `json:"field"`
+	Type  string `json:"type"`
+}
+
+// convert casts fields to another type; missing fields are ignored and values that cannot be
+// cast fail the event, leaving the field as it was.
+type convert []conversion
+
+func newConvert(args json.RawMessage) (Processor, error) {
+	var cfg struct {
+		Fields []conversion `json:"fields"`
+	}
+	err := decodeArgs(args, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Fields) == 0 {
+		return nil, fmt.Errorf("no fields defined")
+	}
+
+	for _, c := range cfg.Fields {
+		switch c.Type {
+		case typeString, typeInteger, typeFloat, typeBoolean:
+		default:
+			return nil, fmt.Errorf("invalid type %q of field %s", c.Type, c.Field)
+		}
+	}
+	return convert(cfg.Fields), nil
+}
+
+func (c convert) Process(e *Event) (bool, error) {
+	for _, conv := range c {
+		v, ok := lookupField(e.Text, conv.Field)
+		if !ok {
+			continue
+		}
+
+		cast, err := convertValue(v, conv.Type)
+		if err != nil {
+			return true, fmt.Errorf("could not convert %s to %s; %s", conv.Field, conv.Type, err)
+		}
+		putField(e.Text, conv.Field, cast)
+	}
+	return true, nil
+}
+
+func convertValue(v interface{}, typ string) (interface{}, error) {
+	switch typ {
+	case typeString:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+
+	case typeInteger:
+		switch v := v.(type) {
+		case string:
+			if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return i, nil
+			}
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, err
+			}
+			return int64(f), nil
+		case float64:
+			return int64(v), nil
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+
+	case typeFloat:
+		switch v := v.(type) {
+		case string:
+			return strconv.ParseFloat(strings.TrimSpace(v), 64)
+		case float64:
+			return v, nil
+		case bool:
+			if v {
+				return 1.0, nil
+			}
+			return 0.0, nil
+		}
+
+	case typeBoolean:
+		switch v := v.(type) {
+		case string:
+			return strconv.ParseBool(strings.TrimSpace(v))
+		case float64:
+			return v != 0, nil
+		case bool:
+			return v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported value %v", v)
+}
+
+// lowercase converts string fields to lower case; other values are left as they are.
+type lowercase []string
+
+func newLowercase(args json.RawMessage) (Processor, error) {
+	var cfg struct {
+		Fields []string `json:"fields"`
+	}
+	err := decodeFields(args, &cfg, &cfg.Fields)
+	return lowercase(cfg.Fields), err
+}
+
+func (l lowercase) Process(e *Event) (bool, error) {
+	for _, field := range l {
+		if s, ok := lookupFieldString(e.Text, field); ok {
+			putField(e.Text, field, strings.ToLower(s))
+		}
+	}
+	return true, nil
+}
+
+// truncateFields shortens string fields to at most MaxCharacters characters.
+type truncateFields struct {
+	Fields        []string `json:"fields"`
+	MaxCharacters int      `json:"max_characters"`
+}
+
+func newTruncateFields(args json.RawMessage) (Processor, error) {
+	t := new(truncateFields)
+	err := decodeFields(args, t, &t.Fields)
+	if err != nil {
+		return nil, err
+	}
+	if t.MaxCharacters <= 0 {
+		return nil, fmt.Errorf("max_characters must be positive")
+	}
+	return t, nil
+}
+
+func (t *truncateFields) Process(e *Event) (bool, error) {
+	for _, field := range t.Fields {
+		s, ok := lookupFieldString(e.Text, field)
+		if !ok || utf8.RuneCountInString(s) <= t.MaxCharacters {
+			continue
+		}
+
+		n := 0
+		for i := range s {
+			if n == t.MaxCharacters {
+				s = s[:i]
+				break
+			}
+			n++
+		}
+		putField(e.Text, field, s)
+	}
+	return true, nil
+}
+
+func lookupFieldString(text map[string]interface{}, field string) (string, bool) {
+	v, ok := lookupField(text, field)
+	if !ok {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok
+}
+
+// flattenConfig configures both flatten and unflatten. Without fields they apply to the whole
+// event text.
+type flattenConfig struct {
+	Fields    []string `json:"fields"`
+	Separator string   `json:"separator"`
+}
+
+func decodeFlatten(args json.RawMessage) (*flattenConfig, error) {
+	cfg := new(flattenConfig)
+	err := decodeArgs(args, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Separator == "" {
+		cfg.Separator = "."
+	}
+	return cfg, nil
+}
+
+// apply replaces each configured object, or the whole text, with the result of fn.
+func (cfg *flattenConfig) apply(e *Event, fn func(map[string]interface{}, string) map[string]interface{}) {
+	if len(cfg.Fields) == 0 {
+		e.Text = fn(e.Text, cfg.Separator)
+		return
+	}
+
+	for _, field := range cfg.Fields {
+		v, ok := lookupField(e.Text, field)
+		if !ok {
+			continue
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			putField(e.Text, field, fn(m, cfg.Separator))
+		}
+	}
+}
+
+// flatten replaces nested objects with keys that join their path with a separator, e.g.
+// {"http":{"method":"GET"}} becomes {"http.method":"GET"}.
+type flatten struct {
+	*flattenConfig
+}
+
+func newFlatten(args json.RawMessage) (Processor, error) {
+	cfg, err := decodeFlatten(args)
+	return flatten{cfg}, err
+}
+
+func (f flatten) Process(e *Event) (bool, error) {
+	f.apply(e, flattenMap)
+	return true, nil
+}
+
+func flattenMap(m map[string]interface{}, sep string) map[string]interface{} {
+	flat := make(map[string]interface{}, len(m))
+
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if prefix != "" {
+				k = prefix + sep + k
+			}
+			if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+				walk(k, nested)
+				continue
+			}
+			flat[k] = v
+		}
+	}
+	walk("", m)
+
+	return flat
+}
+
+// unflatten is the reverse of flatten and nests the keys that contain the separator, e.g.
+// {"http.method":"GET"} becomes {"http":{"method":"GET"}}. A key is left as it is if a
+// non-object value is in the way of its path.
+type unflatten struct {
+	*flattenConfig
+}
+
+func newUnflatten(args json.RawMessage) (Processor, error) {
+	cfg, err := decodeFlatten(args)
+	return unflatten{cfg}, err
+}
+
+func (u unflatten) Process(e *Event) (bool, error) {
+	u.apply(e, unflattenMap)
+	return true, nil
+}
+
+func unflattenMap(m map[string]interface{}, sep string) map[string]interface{} {
+	nested := make(map[string]interface{}, len(m))
+
+	// nest the shorter keys first, so that their objects are merged with longer ones
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ni, nj := strings.Count(keys[i], sep), strings.Count(keys[j], sep)
+		if ni != nj {
+			return ni < nj
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, k := range keys {
+		v := m[k]
+		if obj, ok := v.(map[string]interface{}); ok {
+			v = unflattenMap(obj, sep)
+		}
+
+		parts := strings.Split(k, sep)
+		parent := nested
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := parent[part].(map[string]interface{})
+			if !ok {
+				if _, exists := parent[part]; exists {
+					parent = nil
+					break
+				}
+				child = make(map[string]interface{})
+				parent[part] = child
+			}
+			parent = child
+		}
+
+		if parent == nil {
+			nested[k] = v
+			continue
+		}
+
+		last := parts[len(parts)-1]
+		if existing, ok := parent[last].(map[string]interface{}); ok {
+			if obj, ok := v.(map[string]interface{}); ok {
+				for ck, cv := range obj {
+					existing[ck] = cv
+				}
+				continue
+			}
+		}
+		parent[last] = v
+	}
+
+	return nested
+}
+
+// dropEvent drops the events that match its condition, or every event without one. The
+// condition is an expression like those of include and exclude.
+type dropEvent struct {
+	When string `json:"when"`
+
+	when *expr.Expr
+}
+
+func newDropEvent(args json.RawMessage) (Processor, error) {
+	d := new(dropEvent)
+	if err := decodeArgs(args, d); err != nil {
+		return nil, err
+	}
+
+	if d.When != "" {
+		var err error
+		d.when, err = expr.Parse(d.When)
+		if err != nil {
+			return nil, fmt.Errorf("invalid when condition; %s", err)
+		}
+	}
+	return d, nil
+}
+
+func (d *dropEvent) Process(e *Event) (bool, error) {
+	return d.when != nil && !d.when.Match(textLookup(e)), nil
+}
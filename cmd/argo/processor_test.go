@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestProcessors(t *testing.T) {
+	var tests = []struct {
+		name   string
+		config string
+		text   string
+		exp    string
+		keep   bool
+		err    error
+	}{
+		{
+			"rename",
+			`[{"rename":{"fields":[{"from":"msg","to":"message"},{"from":"missing","to":"other"}]}}]`,
+			`{"msg":"hello"}`,
+			`{"message":"hello"}`,
+			true,
+			nil,
+		}, {
+			"rename nested",
+			`[{"rename":{"fields":[{"from":"http.code","to":"status.code"}]}}]`,
+			`{"http":{"code":200,"method":"GET"}}`,
+			`{"http":{"method":"GET"},"status":{"code":200}}`,
+			true,
+			nil,
+		}, {
+			"drop fields",
+			`[{"drop_fields":{"fields":["password","user.token"]}}]`,
+			`{"password":"secret","user":{"name":"bob","token":"abc"}}`,
+			`{"user":{"name":"bob"}}`,
+			true,
+			nil,
+		}, {
+			"add fields",
+			`[{"add_fields":{"fields":{"env":"prod","service.name":"api"}}}]`,
+			`{"env":"dev"}`,
+			`{"env":"prod","service":{"name":"api"}}`,
+			true,
+			nil,
+		}, {
+			"add fields to a non JSON line",
+			`[{"add_fields":{"fields":{"env":"prod"}}}]`,
+			`not json`,
+			`{"env":"prod"}`,
+			true,
+			nil,
+		}, {
+			"copy fields",
+			`[{"copy_fields":{"fields":[{"from":"req","to":"orig"}]}},{"drop_fields":{"fields":["req.id"]}}]`,
+			`{"req":{"id":1}}`,
+			`{"req":{},"orig":{"id":1}}`,
+			true,
+			nil,
+		}, {
+			"convert",
+			`[{"convert":{"fields":[{"field":"a","type":"integer"},{"field":"b","type":"float"},{"field":"c","type":"boolean"},{"field":"d","type":"string"},{"field":"e","type":"integer"}]}}]`,
+			`{"a":"42","b":"1.5","c":"true","d":12.5,"e":3.9}`,
+			`{"a":42,"b":1.5,"c":true,"d":"12.5","e":3}`,
+			true,
+			nil,
+		}, {
+			"convert failure",
+			`[{"convert":{"fields":[{"field":"a","type":"integer"}]}},{"lowercase":{"fields":["b"]}}]`,
+			`{"a":"many","b":"X"}`,
+			`{"a":"many","b":"x"}`,
+			true,
+			errors.New(`convert; could not convert a to integer; strconv.ParseFloat: parsing "many": invalid syntax`),
+		}, {
+			"mask after convert failure",
+			`[{"convert":{"fields":[{"field":"status","type":"integer"}]}},{"mask":{"fields":"password"}}]`,
+			`{"status":"ok","password":"hunter2"}`,
+			`{"status":"ok","password":"[REDACTED]"}`,
+			true,
+			errors.New(`convert; could not convert status to integer; strconv.ParseFloat: parsing "ok": invalid syntax`),
+		}, {
+			"lowercase",
+			`[{"lowercase":{"fields":["level","code"]}}]`,
+			`{"level":"ERROR","code":500}`,
+			`{"level":"error","code":500}`,
+			true,
+			nil,
+		}, {
+			"truncate fields",
+			`[{"truncate_fields":{"fields":["message","short"],"max_characters":3}}]`,
+			`{"message":"αβγδε","short":"ab"}`,
+			`{"message":"αβγ","short":"ab"}`,
+			true,
+			nil,
+		}, {
+			"flatten",
+			`[{"flatten":{}}]`,
+			`{"http":{"request":{"method":"GET"},"code":200},"empty":{},"tags":["a"]}`,
+			`{"http.request.method":"GET","http.code":200,"empty":{},"tags":["a"]}`,
+			true,
+			nil,
+		}, {
+			"flatten field with separator",
+			`[{"flatten":{"fields":["http"],"separator":"_"}}]`,
+			`{"http":{"request":{"method":"GET"}},"user":{"id":1}}`,
+			`{"http":{"request_method":"GET"},"user":{"id":1}}`,
+			true,
+			nil,
+		}, {
+			"unflatten",
+			`[{"unflatten":{}}]`,
+			`{"http.request.method":"GET","http":{"code":200},"level":"info","level.name":"x"}`,
+			`{"http":{"request":{"method":"GET"},"code":200},"level":"info","level.name":"x"}`,
+			true,
+			nil,
+		}, {
+			"drop event on condition",
+			`[{"drop_event":{"when":"level == 'debug' && exists(trace)"}},{"add_fields":{"fields":{"kept":true}}}]`,
+			`{"level":"debug","trace":"x"}`,
+			`{"level":"debug","trace":"x"}`,
+			false,
+			nil,
+		}, {
+			"keep event not matching condition",
+			`[{"drop_event":{"when":"level == 'debug' && code == 404"}}]`,
+			`{"level":"debug","code":200}`,
+			`{"level":"debug","code":200}`,
+			true,
+			nil,
+		}, {
+			"drop every event",
+			`[{"drop_event":{}}]`,
+			`{"level":"info"}`,
+			`{"level":"info"}`,
+			false,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var configs []ProcessorConfig
+			if err := json.Unmarshal([]byte(tt.config), &configs); err != nil {
+				t.Fatal(err)
+			}
+
+			ps, err := NewProcessors(configs)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := "test.log"
+			e := NewEvent(&path, 1, 0, &tt.text)
+
+			keep, err := ps.Process(&e)
+			assertEq(err, tt.err, t)
+			assertEq(keep, tt.keep, t)
+
+			var exp map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.exp), &exp); err != nil {
+				t.Fatal(err)
+			}
+
+			// compare through JSON, since converted values are not float64 like decoded ones
+			text, _ := json.Marshal(e.Text)
+			var actual map[string]interface{}
+			json.Unmarshal(text, &actual)
+			assertEq(actual, exp, t)
+		})
+	}
+}
+
+func TestNewProcessors(t *testing.T) {
+	var tests = []struct {
+		config string
+		err    error
+	}{
+		{`[]`, nil},
+		{`[{"lowercase":{"fields":["a"]}}]`, nil},
+		{`[{"uppercase":{"fields":["a"]}}]`, errors.New(`unknown processor "uppercase"`)},
+		{`[{"lowercase":{"fields":["a"]},"rename":{}}]`, errors.New("processor 0 must have exactly one name, found 2")},
+		{`[{"lowercase":{}}]`, errors.New("processor lowercase; no fields defined")},
+		{`[{"lowercase":{"field":["a"]}}]`, errors.New(`processor lowercase; json: unknown field "field"`)},
+		{`[{"rename":{"fields":[{"from":"a"}]}}]`, errors.New("processor rename; fields need both from and to")},
+		{`[{"convert":{"fields":[{"field":"a","type":"date"}]}}]`, errors.New(`processor convert; invalid type "date" of field a`)},
+		{`[{"drop_event":{"when":"level ="}}]`, errors.New("processor drop_event; invalid when condition; unexpected character '=' at offset 6")},
+		{`[{"truncate_fields":{"fields":["a"]}}]`, errors.New("processor truncate_fields; max_characters must be positive")},
+	}
+
+	for _, tt := range tests {
+		var configs []ProcessorConfig
+		if err := json.Unmarshal([]byte(tt.config), &configs); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := NewProcessors(configs)
+		assertEq(err, tt.err, t)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/mresvanis/argo/pkg/logging"
+	"github.com/mresvanis/argo/pkg/watch"
+)
+
+const reloadDelay = 100 * time.Millisecond
+
+// Reloader applies the changes of the configuration file to the running output and harvester.
+type Reloader struct {
+	sync.Mutex
+
+	path   string
+	config *Config
+	out    Output
+	h      *Harvester
+	log    *logging.Logger
+	digest []byte
+}
+
+func NewReloader(path string, cfg *Config, out Output, h *Harvester) *Reloader {
+	r := new(Reloader)
+
+	r.path = path
+	r.config = cfg
+	r.out = out
+	r.h = h
+	r.log = cfg.logger("main")
+	r.digest, _ = fileDigest(path)
+
+	return r
+}
+
+// Reload parses the configuration file again and applies it. The running configuration is kept
+// if the file is invalid.
+func (r *Reloader) Reload() error {
+	r.Lock()
+	defer r.Unlock()
+
+	r.digest, _ = fileDigest(r.path)
+
+	next, err := parseConfigFile(r.path)
+	if err != nil {
+		return err
+	}
+
+	return r.apply(next)
+}
+
+// apply replaces the running configuration with next. Settings that cannot change at runtime keep
+// their running values, with a warning.
+func (r *Reloader) apply(next *Config) error {
+	cur := r.config
+
+	for _, name := range next.inherit(cur) {
+		r.log.Warn("setting changed, restart to apply it", "setting", name)
+	}
+
+	err := r.out.Reload(next)
+	if err != nil {
+		return fmt.Errorf("cannot reload output; %s", err)
+	}
+
+	r.h.Reload(next)
+	r.config = next
+
+	r.log.Info("reloaded configuration", "path", r.path, "paths", len(next.patterns()))
+	return nil
+}
+
+// Watch reloads the configuration whenever its file changes, until term is closed. Both the file
+// and its directory are watched, as editors often replace the file instead of writing to it.
+func (r *Reloader) Watch(watcher watch.Watcher, term <-chan struct{}) {
+	dir := filepath.Dir(r.path)
+	dirCh, err := watcher.Watch(dir)
+	if err != nil {
+		r.log.Warn("could not watch configuration directory", "dir", dir, "error", err)
+	}
+	defer watcher.Unwatch(dir)
+
+	fileCh, _ := watcher.Watch(r.path)
+	defer func() { watcher.Unwatch(r.path) }()
+
+	for {
+		select {
+		case <-term:
+			return
+		case <-dirCh:
+			// the file may have been replaced, so watch the current one
+			watcher.Unwatch(r.path)
+			fileCh, _ = watcher.Watch(r.path)
+		case <-fileCh:
+		}
+
+		// let the writer finish, as the file may be written in several steps
+		select {
+		case <-term:
+			return
+		case <-time.After(reloadDelay):
+		}
+
+		if !r.changed() {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			r.log.Error("could not reload configuration", "path", r.path, "error", err)
+		}
+	}
+}
+
+// changed reports whether the content of the configuration file differs from the last one read.
+func (r *Reloader) changed() bool {
+	digest, err := fileDigest(r.path)
+	if err != nil {
+		return false
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	return !bytes.Equal(digest, r.digest)
+}
+
+func fileDigest(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// inherit copies the state of the running configuration cur, and the settings that can only
+// change on restart, whose names are returned if they differ.
+func (cfg *Config) inherit(cur *Config) []string {
+	var changed []string
+	if cfg.BufferSize != cur.BufferSize {
+		changed = append(changed, "buffer_size")
+		cfg.BufferSize = cur.BufferSize
+	}
+	if cfg.ShutdownTimeout != cur.ShutdownTimeout {
+		changed = append(changed, "shutdown_timeout")
+		cfg.ShutdownTimeout = cur.ShutdownTimeout
+		cfg.shutdownTimeout = cur.shutdownTimeout
+	}
+	if !reflect.DeepEqual(cfg.Kubernetes, cur.Kubernetes) {
+		changed = append(changed, "kubernetes")
+		cfg.Kubernetes = cur.Kubernetes
+	}
+	if !reflect.DeepEqual(cfg.HTTP, cur.HTTP) {
+		changed = append(changed, "http")
+		cfg.HTTP = cur.HTTP
+	}
+	if !reflect.DeepEqual(cfg.Log, cur.Log) {
+		changed = append(changed, "log")
+		cfg.Log = cur.Log
+	}
+	if !reflect.DeepEqual(cfg.Monitoring, cur.Monitoring) {
+		changed = append(changed, "monitoring")
+		cfg.Monitoring = cur.Monitoring
+	}
+
+	cfg.once = cur.once
+	cfg.path = cur.path
+	cfg.watch = cur.watch
+	cfg.host = cur.host
+	cfg.agent = cur.agent
+	cfg.pods = cur.pods
+	cfg.metrics = cur.metrics
+	cfg.log = cur.log
+
+	return changed
+}
+
+// inputSettings returns the settings of the configuration that apply to an input, so that their
+// change restarts it. The paths, the output host and the restart only settings do not.
+func inputSettings(cfg *Config) string {
+	c := *cfg
+	c.Paths = nil
+	c.Inputs = nil
+	c.Host = ""
+	c.Timeout = 0
+	c.BufferSize = 0
+	c.ShutdownTimeout = ""
+	c.Kubernetes = KubernetesConfig{}
+	c.HTTP = HTTPConfig{}
+	c.Log = LogConfig{}
+	c.Monitoring = MonitoringConfig{}
+
+	data, _ := json.Marshal(c)
+	if c.input != nil {
+		// the other settings of the input are applied to the configuration itself
+		meta, _ := json.Marshal(c.input.MetaConfig)
+		data = append(data, meta...)
+	}
+	return string(data)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// receive returns the next batch of the output, failing the test if none arrives.
+func receive(out *testOutput, t *testing.T) []Event {
+	select {
+	case events := <-out.input:
+		return events
+	case <-time.After(5 * time.Second):
+		t.Fatal("no events were dispatched")
+	}
+	return nil
+}
+
+func TestHarvesterReload(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a.log")
+	b := filepath.Join(dir, "b.log")
+	for _, path := range []string{a, b} {
+		if err := ioutil.WriteFile(path, []byte(`{"test":"field"}`+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := *testcfg
+	cfg.Paths = []string{a}
+	cfg.dispatchInterval = 0
+
+	out := newTestOutput()
+	h := NewHarvester(&cfg, out, reg, testwatcher)
+	h.Start()
+	defer func() {
+		h.Stop()
+		h.Wait()
+	}()
+
+	events := receive(out, t)
+	assertEq(*events[0].Source, a, t)
+	out.ack(events)
+
+	// replacing the path stops the input of a and starts one for b
+	next := cfg
+	next.Paths = []string{b}
+	h.Reload(&next)
+
+	events = receive(out, t)
+	assertEq(*events[0].Source, b, t)
+	out.ack(events)
+
+	waitFor(t, func() bool {
+		active := h.Active()
+		return len(active) == 1 && active[0].Path == b
+	})
+
+	// changing the settings of the inputs restarts them from their acked offset
+	tagged := next
+	tagged.Tags = []string{"reloaded"}
+	h.Reload(&tagged)
+
+	waitFor(t, func() bool { return len(h.Stats()) == 3 && len(h.Active()) == 1 })
+
+	f, err := os.OpenFile(b, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"test":"again"}` + "\n")
+	f.Close()
+
+	events = receive(out, t)
+	assertEq(len(events), 1, t)
+	assertEq(events[0].Text, map[string]interface{}{"test": "again"}, t)
+	assertEq(events[0].Tags, []string{"reloaded"}, t)
+	out.ack(events)
+}
+
+func TestConfigInherit(t *testing.T) {
+	cur := *testcfg
+	cur.once = true
+	cur.host = &HostMeta{Hostname: "web-1"}
+
+	next := *testcfg
+	next.Paths = []string{"./other.log"}
+	next.BufferSize = 10
+	next.HTTP.Listen = "127.0.0.1:9700"
+
+	changed := next.inherit(&cur)
+	assertEq(changed, []string{"buffer_size", "http"}, t)
+	assertEq(next.BufferSize, cur.BufferSize, t)
+	assertEq(next.HTTP, cur.HTTP, t)
+	assertEq(next.Paths, []string{"./other.log"}, t)
+	assertEq(next.once, true, t)
+	assertEq(next.host, cur.host, t)
+
+	assertEq(inputSettings(&cur) == inputSettings(&next), true, t)
+	next.Tags = []string{"new"}
+	assertEq(inputSettings(&cur) == inputSettings(&next), false, t)
+}
+
+func TestReloader(t *testing.T) {
+	reg, cleanup := newTestRegistry(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"host":"http://localhost:9200","paths":["./a.log"]}`)
+
+	cfg, err := parseConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := newTestOutput()
+	h := NewHarvester(cfg, out, reg, nil)
+	defer func() {
+		h.Stop()
+		h.Wait()
+	}()
+	r := NewReloader(path, cfg, out, h)
+	assertEq(r.changed(), false, t)
+
+	// an invalid file keeps the running configuration
+	write(`{"host":"http://localhost:9200","paths":[]}`)
+	assertEq(r.changed(), true, t)
+	if err := r.Reload(); err == nil || !strings.Contains(err.Error(), "no paths defined") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	assertEq(r.config, cfg, t)
+	assertEq(r.changed(), false, t)
+
+	write(`{"host":"http://localhost:9200","paths":["./missing.log"]}`)
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	assertEq(r.config.Paths, []string{"./missing.log"}, t)
+	assertEq(h.currentConfig(), r.config, t)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mresvanis/argo/pkg/logging"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// HTTPConfig configures the HTTP server of the process, which is disabled without an address to
+// listen on. The address is either a TCP address or the path of a unix socket prefixed by "unix:".
+type HTTPConfig struct {
+	Listen string       `json:"listen"`
+	Health HealthConfig `json:"health"`
+}
+
+// Server exposes the metrics, the health and the status of the process over HTTP.
+type Server struct {
+	mux    *http.ServeMux
+	server *http.Server
+	log    *logging.Logger
+}
+
+func NewServer(cfg *Config) *Server {
+	srv := new(Server)
+
+	srv.mux = http.NewServeMux()
+	srv.mux.Handle("/metrics", cfg.metrics.registry.Handler())
+
+	srv.server = &http.Server{Addr: cfg.HTTP.Listen, Handler: srv.mux}
+	srv.log = cfg.logger("http")
+
+	return srv
+}
+
+// Start listens on the configured address and serves requests in the background.
+func (srv *Server) Start() error {
+	network, address := listenAddr(srv.server.Addr)
+	if network == "unix" {
+		// a socket left behind by a previous process that did not exit cleanly
+		if info, err := os.Stat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(address)
+		}
+	}
+
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	srv.log.Info("listening", "address", ln.Addr())
+
+	go func() {
+		err := srv.server.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			srv.log.Error("stopped serving", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// Handle serves the specified pattern with the handler, which may be added once the server has
+// started.
+func (srv *Server) Handle(pattern string, handler http.Handler) {
+	srv.mux.Handle(pattern, handler)
+}
+
+// Stop closes the listener and waits for the requests in progress to complete.
+func (srv *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	srv.server.Shutdown(ctx)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const statusTimeout = 5 * time.Second
+
+// InputStatus is the state of an active input, as served by the status API.
+type InputStatus struct {
+	Path      string    `json:"path"`
+	Inode     uint64    `json:"inode"`
+	Offset    int64     `json:"offset"`
+	Size      int64     `json:"size"`
+	Lag       int64     `json:"lag"`
+	LastRead  time.Time `json:"last_read"`
+	LastAck   time.Time `json:"last_ack"`
+	Pending   int       `json:"pending"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+func newInputStatus(s InputStats) InputStatus {
+	status := InputStatus{
+		Path:      s.Path,
+		Inode:     s.Inode,
+		Offset:    s.Offset,
+		Size:      s.Size,
+		LastRead:  s.LastRead,
+		LastAck:   s.LastAck,
+		Pending:   s.Pending,
+		LastError: s.LastError,
+	}
+	if s.Size > s.Offset {
+		status.Lag = s.Size - s.Offset
+	}
+	return status
+}
+
+// statusHandler serves the status of the active inputs of the harvester as JSON, sorted by path.
+func statusHandler(h *Harvester) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		active := h.Active()
+
+		statuses := make([]InputStatus, len(active))
+		for i, s := range active {
+			statuses[i] = newInputStatus(s)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statuses)
+	})
+}
+
+// listenAddr returns the network and address of the listen setting, which is either a TCP
+// address or the path of a unix socket prefixed by "unix:".
+func listenAddr(listen string) (network, address string) {
+	if strings.HasPrefix(listen, "unix:") {
+		return "unix", strings.TrimPrefix(listen, "unix:")
+	}
+	return "tcp", listen
+}
+
+// fetchStatus queries the status API of the process that listens on the specified address.
+func fetchStatus(listen string) ([]InputStatus, error) {
+	network, address := listenAddr(listen)
+
+	client := &http.Client{
+		Timeout: statusTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, address)
+			},
+		},
+	}
+
+	// the host is ignored, as the transport always dials the listen address
+	res, err := client.Get("http://argo/status")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	var statuses []InputStatus
+	err = json.NewDecoder(res.Body).Decode(&statuses)
+	if err != nil {
+		return nil, fmt.Errorf("invalid status response; %s", err)
+	}
+
+	return statuses, nil
+}
+
+// renderStatus writes the statuses as a table, with the times relative to now.
+func renderStatus(w io.Writer, statuses []InputStatus, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "PATH\tINODE\tOFFSET\tSIZE\tLAG\tLAST READ\tLAST ACK\tPENDING\tLAST ERROR")
+	for _, s := range statuses {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\t%s\t%d\t%s\n",
+			s.Path,
+			s.Inode,
+			s.Offset,
+			s.Size,
+			s.Lag,
+			ago(s.LastRead, now),
+			ago(s.LastAck, now),
+			s.Pending,
+			s.LastError,
+		)
+	}
+
+	return tw.Flush()
+}
+
+// ago returns how long before now the specified time was, or "-" if it is zero.
+func ago(t time.Time, now time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return now.Sub(t).Truncate(time.Second).String() + " ago"
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "argo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2019, 6, 9, 12, 0, 0, 0, time.UTC)
+
+	cfg := *testcfg
+	cfg.HTTP.Listen = "unix:" + filepath.Join(dir, "argo.sock")
+	cfg.metrics = NewMetrics()
+
+	h := NewHarvester(&cfg, nil, nil, nil)
+	for _, s := range []InputStats{
+		{Path: "/var/log/b.log", Inode: 12, Offset: 100, Size: 100, LastRead: now.Add(-time.Second), LastAck: now.Add(-time.Second)},
+		{Path: "/var/log/a.log", Inode: 11, Offset: 100, Size: 4196, Pending: 128, LastRead: now, LastError: "connection refused"},
+	} {
+		h.inputs[s.Path] = &statsInput{s}
+	}
+
+	srv := NewServer(&cfg)
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	srv.Handle("/status", statusHandler(h))
+
+	statuses, err := fetchStatus(cfg.HTTP.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEq(len(statuses), 2, t)
+	assertEq(statuses[0].Path, "/var/log/a.log", t)
+	assertEq(statuses[0].Lag, int64(4096), t)
+	assertEq(statuses[0].LastRead.Equal(now), true, t)
+	assertEq(statuses[1].Lag, int64(0), t)
+
+	var buf bytes.Buffer
+	if err := renderStatus(&buf, statuses, now); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := "" +
+		"PATH            INODE  OFFSET  SIZE  LAG   LAST READ  LAST ACK  PENDING  LAST ERROR\n" +
+		"/var/log/a.log  11     100     4196  4096  0s ago     -         128      connection refused\n" +
+		"/var/log/b.log  12     100     100   0     1s ago     1s ago    0        \n"
+	if buf.String() != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, buf.String())
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+	for listen, exp := range map[string][2]string{
+		"127.0.0.1:9700":          {"tcp", "127.0.0.1:9700"},
+		":9700":                   {"tcp", ":9700"},
+		"unix:/var/run/argo.sock": {"unix", "/var/run/argo.sock"},
+	} {
+		network, address := listenAddr(listen)
+		assertEq([2]string{network, address}, exp, t)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Layouts with a special meaning in the timestamp configuration; any other layout is a Go time
+// layout.
+const (
+	layoutRFC3339     = "RFC3339"
+	layoutRFC3339Nano = "RFC3339Nano"
+	layoutUnix        = "UNIX"
+	layoutUnixMs      = "UNIX_MS"
+)
+
+// TimestampConfig describes how the @timestamp of an event is extracted from its text.
+type TimestampConfig struct {
+	// Field is the, possibly dotted, path of the field holding the timestamp.
+	Field string `json:"field"`
+
+	// Layouts are tried in order until one parses the field value.
+	Layouts []string `json:"layouts"`
+
+	// Timezone is the location of timestamps that do not specify one. It defaults to UTC.
+	Timezone string `json:"timezone"`
+
+	location *time.Location
+}
+
+func (tc *TimestampConfig) parse() error {
+	if tc.Field == "" {
+		return nil
+	}
+
+	if len(tc.Layouts) == 0 {
+		tc.Layouts = []string{layoutRFC3339}
+	}
+
+	tc.location = time.UTC
+	if tc.Timezone != "" {
+		loc, err := time.LoadLocation(tc.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp timezone; %s", err)
+		}
+		tc.location = loc
+	}
+
+	return nil
+}
+
+// extract returns the timestamp of the event text, or fallback if the field is missing or none
+// of the layouts parses it.
+func (tc *TimestampConfig) extract(text map[string]interface{}, fallback time.Time) time.Time {
+	if tc.Field == "" {
+		return fallback
+	}
+
+	value, ok := lookupField(text, tc.Field)
+	if !ok {
+		return fallback
+	}
+
+	for _, layout := range tc.Layouts {
+		if ts, ok := parseTimestamp(value, layout, tc.location); ok {
+			return ts
+		}
+	}
+
+	return fallback
+}
+
+func parseTimestamp(value interface{}, layout string, loc *time.Location) (time.Time, bool) {
+	switch layout {
+	case layoutUnix, layoutUnixMs:
+		var epoch float64
+		switch v := value.(type) {
+		case float64:
+			epoch = v
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return time.Time{}, false
+			}
+			epoch = f
+		default:
+			return time.Time{}, false
+		}
+
+		unit := time.Second
+		if layout == layoutUnixMs {
+			unit = time.Millisecond
+		}
+		// split the epoch so that the fraction does not lose precision when scaled
+		whole, frac := math.Modf(epoch)
+		nsec := int64(whole)*int64(unit) + int64(math.Round(frac*float64(unit)/1e3))*1e3
+		return time.Unix(0, nsec).UTC(), true
+
+	case layoutRFC3339:
+		layout = time.RFC3339
+	case layoutRFC3339Nano:
+		layout = time.RFC3339Nano
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	ts, err := time.ParseInLocation(layout, s, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimestampConfigExtract(t *testing.T) {
+	athens, err := time.LoadLocation("Europe/Athens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fallback := time.Date(2019, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		name string
+		cfg  TimestampConfig
+		text map[string]interface{}
+		ts   time.Time
+	}{
+		{
+			"no field configured",
+			TimestampConfig{},
+			map[string]interface{}{"time": "2019-06-09T10:00:00Z"},
+			fallback,
+		}, {
+			"rfc3339",
+			TimestampConfig{Field: "time"},
+			map[string]interface{}{"time": "2019-06-09T10:00:00.123+02:00"},
+			time.Date(2019, 6, 9, 8, 0, 0, 123e6, time.UTC),
+		}, {
+			"epoch millis",
+			TimestampConfig{Field: "ts", Layouts: []string{"UNIX_MS"}},
+			map[string]interface{}{"ts": 1560074400123.0},
+			time.Date(2019, 6, 9, 10, 0, 0, 123e6, time.UTC),
+		}, {
+			"epoch seconds string",
+			TimestampConfig{Field: "ts", Layouts: []string{"UNIX"}},
+			map[string]interface{}{"ts": "1560074400"},
+			time.Date(2019, 6, 9, 10, 0, 0, 0, time.UTC),
+		}, {
+			"custom layout with timezone",
+			TimestampConfig{Field: "log.time", Layouts: []string{"RFC3339", "2006-01-02 15:04:05"}, Timezone: "Europe/Athens"},
+			map[string]interface{}{"log": map[string]interface{}{"time": "2019-06-09 13:00:00"}},
+			time.Date(2019, 6, 9, 13, 0, 0, 0, athens),
+		}, {
+			"unparsable",
+			TimestampConfig{Field: "time", Layouts: []string{"UNIX_MS"}},
+			map[string]interface{}{"time": "yesterday"},
+			fallback,
+		}, {
+			"missing field",
+			TimestampConfig{Field: "time"},
+			map[string]interface{}{"message": "no time"},
+			fallback,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.parse(); err != nil {
+				t.Fatal(err)
+			}
+
+			ts := tt.cfg.extract(tt.text, fallback)
+			if !ts.Equal(tt.ts) {
+				t.Fatalf("expected %s, got %s", tt.ts, ts)
+			}
+		})
+	}
+}
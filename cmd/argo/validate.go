@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+const redacted = "REDACTED"
+
+// secretParams are the parts of URL query parameter names whose values are redacted.
+var secretParams = []string{"token", "key", "secret", "password", "auth"}
+
+// problem is an issue of the configuration found by check. Warnings do not make the configuration
+// invalid, as they may be resolved by the time the files are harvested.
+type problem struct {
+	warning bool
+	msg     string
+}
+
+func (p problem) String() string {
+	if p.warning {
+		return "warning: " + p.msg
+	}
+	return "error: " + p.msg
+}
+
+// check inspects the paths of every input: paths must exist and be readable files, and glob
+// patterns should match files, which must be readable.
+func (cfg *Config) check() []problem {
+	var problems []problem
+
+	for _, pattern := range cfg.patterns() {
+		if !hasMeta(pattern) {
+			if msg := checkFile(pattern); msg != "" {
+				problems = append(problems, problem{msg: msg})
+			}
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			problems = append(problems, problem{msg: fmt.Sprintf("invalid path pattern %q", pattern)})
+			continue
+		}
+		if len(matches) == 0 {
+			problems = append(problems, problem{warning: true, msg: fmt.Sprintf("path %q matches no files", pattern)})
+			continue
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err == nil && info.IsDir() {
+				// directories matching a pattern are skipped by the harvester
+				continue
+			}
+			if msg := checkFile(match); msg != "" {
+				problems = append(problems, problem{msg: msg})
+			}
+		}
+	}
+
+	return problems
+}
+
+// checkFile describes why the file at path cannot be harvested, or returns an empty string.
+func checkFile(path string) string {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Sprintf("path %q does not exist", path)
+	}
+	if err != nil {
+		return fmt.Sprintf("path %q cannot be read; %s", path, err)
+	}
+	if info.IsDir() {
+		return fmt.Sprintf("path %q is a directory", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Sprintf("path %q cannot be read; %s", path, err)
+	}
+	f.Close()
+
+	return ""
+}
+
+// redacted returns a copy of the configuration without the secrets of its URLs and the keys of
+// its processors.
+func (cfg *Config) redacted() *Config {
+	c := *cfg
+	c.Host = redactURL(c.Host)
+	c.Kubernetes.APIServer = redactURL(c.Kubernetes.APIServer)
+	c.Processors = redactProcessors(c.Processors)
+	return &c
+}
+
+// redactProcessors returns a copy of the processor configurations with the HMAC key of mask
+// processors replaced.
+func redactProcessors(ps []ProcessorConfig) []ProcessorConfig {
+	res := make([]ProcessorConfig, len(ps))
+	for i, pc := range ps {
+		res[i] = make(ProcessorConfig, len(pc))
+		for name, args := range pc {
+			res[i][name] = args
+			if name != "mask" {
+				continue
+			}
+
+			var fields map[string]json.RawMessage
+			if json.Unmarshal(args, &fields) != nil || fields["key"] == nil {
+				continue
+			}
+			fields["key"], _ = json.Marshal(redacted)
+			res[i][name], _ = json.Marshal(fields)
+		}
+	}
+	return res
+}
+
+// redactURL replaces the password and the values of secret query parameters of a URL.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		return s
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name := range query {
+			for _, secret := range secretParams {
+				if strings.Contains(strings.ToLower(name), secret) {
+					query.Set(name, redacted)
+					break
+				}
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	return u.String()
+}
+
+// validateConfig checks the configuration file and the paths it harvests, printing every problem.
+// It fails if the file is invalid or has any problem that is not a warning.
+func validateConfig(c *cli.Context) error {
+	path := c.GlobalString("config")
+
+	cfg, err := parseConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	return printProblems(os.Stdout, path, cfg.check())
+}
+
+func printProblems(w io.Writer, path string, problems []problem) error {
+	errs := 0
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+		if !p.warning {
+			errs++
+		}
+	}
+
+	if errs > 0 {
+		return fmt.Errorf("configuration %s is invalid", path)
+	}
+	fmt.Fprintf(w, "configuration %s is valid\n", path)
+	return nil
+}
+
+// showConfig prints the effective configuration, with every default applied and its secrets
+// redacted, as JSON.
+func showConfig(c *cli.Context) error {
+	cfg, err := parseConfigFile(c.GlobalString("config"))
+	if err != nil {
+		return err
+	}
+
+	return printConfig(os.Stdout, cfg)
+}
+
+func printConfig(w io.Writer, cfg *Config) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(cfg.redacted())
+	if err != nil {
+		return fmt.Errorf("cannot encode configuration; %s", err)
+	}
+	return nil
+}
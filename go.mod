@@ -3,8 +3,20 @@ module github.com/mresvanis/argo
 go 1.12
 
 require (
+	github.com/BurntSushi/toml v1.0.0
+	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/elastic/go-elasticsearch/v7 v7.1.1
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/klauspost/compress v1.9.8
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/prometheus/client_golang v0.9.0
+	github.com/prometheus/client_model v0.0.0-20170216185247-6f3806018612 // indirect
+	github.com/prometheus/common v0.0.0-20181218105931-67670fe90761
+	github.com/prometheus/procfs v0.0.0-20181204211112-1dc9a6cbc91a // indirect
 	github.com/urfave/cli v1.20.0
-	go.etcd.io/bbolt v1.3.2
-	golang.org/x/xerrors v0.0.0-20190513163551-3ee3066db522
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/text v0.3.2
+	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543
+	google.golang.org/protobuf v1.27.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
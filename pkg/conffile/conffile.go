@@ -0,0 +1,332 @@
+// Package conffile loads configuration documents from JSON, YAML and TOML files, with environment
+// variable interpolation and includes.
+package conffile
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// IncludeKey is the top level key of the main configuration file that lists the glob patterns of
+// the files to include, relative to its directory. A directory includes its configuration files.
+const IncludeKey = "include_files"
+
+// Document is the content of a configuration file.
+type Document struct {
+	Path string
+	Data map[string]interface{}
+}
+
+// Lookup returns the value of an environment variable, and whether it is set.
+type Lookup func(name string) (string, bool)
+
+// Load reads the configuration file at path and the files it includes, in the order they should
+// be merged. The format of each file is chosen by its extension: .yaml and .yml for YAML, .toml
+// for TOML and JSON otherwise. The ${VAR} and ${VAR:-default} references of the string values of
+// YAML and TOML files are replaced using lookup, while JSON files are read as they are. Errors
+// name the file and, when known, the key.
+func Load(path string, lookup Lookup) ([]Document, error) {
+	main, err := load(path, lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns, err := includes(main)
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %w", path, err)
+	}
+	delete(main.Data, IncludeKey)
+	docs := []Document{main}
+
+	files, err := expandIncludes(filepath.Dir(path), patterns)
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %w", path, err)
+	}
+	for _, file := range files {
+		if file == path {
+			continue
+		}
+		doc, err := load(file, lookup)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := doc.Data[IncludeKey]; ok {
+			return nil, xerrors.Errorf("%s: key %s: only the main configuration file may include files", file, IncludeKey)
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+func load(path string, lookup Lookup) (Document, error) {
+	doc := Document{Path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return doc, err
+	}
+
+	var v interface{}
+	interpolated := true
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		v, err = parseYAML(data)
+	case ".toml":
+		v, err = parseTOML(data)
+	default:
+		v, err = parseJSON(data)
+		interpolated = false
+	}
+	if err != nil {
+		return doc, xerrors.Errorf("%s: %w", path, err)
+	}
+
+	if interpolated {
+		v, err = expand(v, "", lookup)
+		if err != nil {
+			return doc, xerrors.Errorf("%s: %w", path, err)
+		}
+	}
+
+	switch m := v.(type) {
+	case map[string]interface{}:
+		doc.Data = m
+	case nil:
+		doc.Data = make(map[string]interface{})
+	default:
+		return doc, xerrors.Errorf("%s: expected a mapping of settings", path)
+	}
+	return doc, nil
+}
+
+func parseJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	err := dec.Decode(&v)
+	if serr, ok := err.(*json.SyntaxError); ok {
+		line := 1 + bytes.Count(data[:serr.Offset], []byte("\n"))
+		return nil, xerrors.Errorf("line %d: %w", line, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, xerrors.New("unexpected content after the configuration")
+	}
+	return v, nil
+}
+
+func includes(doc Document) ([]string, error) {
+	switch v := doc.Data[IncludeKey].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		patterns := make([]string, len(v))
+		for i, p := range v {
+			s, ok := p.(string)
+			if !ok {
+				return nil, xerrors.Errorf("key %s[%d]: expected a string", IncludeKey, i)
+			}
+			patterns[i] = s
+		}
+		return patterns, nil
+	}
+	return nil, xerrors.Errorf("key %s: expected a string or a list of strings", IncludeKey)
+}
+
+// expandIncludes returns the files matched by the patterns, sorted per pattern. A pattern that
+// matches nothing is not an error, so that an empty conf.d directory may be included.
+func expandIncludes(dir string, patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, xerrors.Errorf("key %s: invalid pattern %q", IncludeKey, pattern)
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				files = append(files, match)
+				continue
+			}
+
+			entries, err := ioutil.ReadDir(match)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range entries {
+				if !e.IsDir() && isConfigFile(e.Name()) {
+					files = append(files, filepath.Join(match, e.Name()))
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+func isConfigFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml", ".toml":
+		return true
+	}
+	return false
+}
+
+// expand replaces the variable references of the strings of v, whose key is key, and resolves the
+// type of the plain YAML scalars once replaced.
+func expand(v interface{}, key string, lookup Lookup) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return interpolate(v, key, lookup)
+	case plain:
+		s, err := interpolate(string(v), key, lookup)
+		if err != nil {
+			return nil, err
+		}
+		return resolve(s), nil
+	case map[string]interface{}:
+		for k, item := range v {
+			name := k
+			if key != "" {
+				name = key + "." + k
+			}
+			expanded, err := expand(item, name, lookup)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = expanded
+		}
+	case []interface{}:
+		for i, item := range v {
+			expanded, err := expand(item, key+"["+strconv.Itoa(i)+"]", lookup)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+	}
+	return v, nil
+}
+
+// interpolate replaces the ${VAR} and ${VAR:-default} references of s. The default applies when
+// the variable is unset or empty, and $$ stands for a literal $.
+func interpolate(s, key string, lookup Lookup) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+			continue
+		case '{':
+		default:
+			b.WriteByte('$')
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", xerrors.Errorf("key %s: unterminated variable reference in %q", key, s)
+		}
+		ref := s[i+2 : i+end]
+		i += end
+
+		name, def, hasDefault := ref, "", false
+		if j := strings.Index(ref, ":-"); j >= 0 {
+			name, def, hasDefault = ref[:j], ref[j+2:], true
+		}
+		if !validName(name) {
+			return "", xerrors.Errorf("key %s: invalid variable name %q", key, name)
+		}
+
+		value, ok := lookup(name)
+		switch {
+		case ok && value != "":
+			b.WriteString(value)
+		case hasDefault:
+			b.WriteString(def)
+		case ok:
+		default:
+			return "", xerrors.Errorf("key %s: variable %q is not set", key, name)
+		}
+	}
+	return b.String(), nil
+}
+
+func validName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge merges the documents in order: mappings are merged, lists are concatenated and any other
+// value replaces the previous one.
+func Merge(docs []Document) map[string]interface{} {
+	merged := make(map[string]interface{})
+	for _, doc := range docs {
+		mergeMap(merged, doc.Data)
+	}
+	return merged
+}
+
+func mergeMap(dst, src map[string]interface{}) {
+	for k, v := range src {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if m, ok := dst[k].(map[string]interface{}); ok {
+				mergeMap(m, v)
+				continue
+			}
+			m := make(map[string]interface{})
+			mergeMap(m, v)
+			dst[k] = m
+		case []interface{}:
+			if l, ok := dst[k].([]interface{}); ok {
+				dst[k] = append(l, v...)
+				continue
+			}
+			dst[k] = append([]interface{}(nil), v...)
+		default:
+			dst[k] = v
+		}
+	}
+}
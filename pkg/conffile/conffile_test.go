@@ -0,0 +1,177 @@
+package conffile
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "conffile")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func testEnv(env map[string]string) Lookup {
+	return func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, cleanup := writeFiles(t, map[string]string{
+		"argo.yaml": `host: ${ES_HOST:-http://localhost:9200}
+buffer_size: ${BUFFER_SIZE}
+paths: [/var/log/app.log]
+fields:
+  env: ${ENV}
+  cost: "$$5"
+include_files: conf.d
+`,
+		"conf.d/10-nginx.toml": `paths = ["/var/log/nginx/*.log"]
+[fields]
+team = "web"
+`,
+		"conf.d/20-once.json":  `{"once": true, "fields": {"env": "prod-override", "pattern": "^${ENV}$$"}}`,
+		"conf.d/README":        `not a configuration file`,
+		"conf.d/.hidden.yaml":  `invalid: [`,
+		"conf.d/30-empty.yml":  "# nothing yet\n",
+		"conf.d/sub/skip.yaml": `invalid: [`,
+	})
+	defer cleanup()
+
+	docs, err := Load(filepath.Join(dir, "argo.yaml"), testEnv(map[string]string{"BUFFER_SIZE": "500", "ENV": "prod"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, doc := range docs {
+		paths = append(paths, strings.TrimPrefix(doc.Path, dir+"/"))
+	}
+	if exp := []string{"argo.yaml", "conf.d/10-nginx.toml", "conf.d/20-once.json", "conf.d/30-empty.yml"}; !reflect.DeepEqual(paths, exp) {
+		t.Fatalf("expected documents %v, got %v", exp, paths)
+	}
+
+	data, err := json.Marshal(Merge(docs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `{"buffer_size":500,"fields":{"cost":"$5","env":"prod-override","pattern":"^${ENV}$$","team":"web"},"host":"http://localhost:9200","once":true,"paths":["/var/log/app.log","/var/log/nginx/*.log"]}`
+	if string(data) != exp {
+		t.Fatalf("expected %s, got %s", exp, data)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{
+			name:  "unset variable",
+			files: map[string]string{"argo.yaml": "fields:\n  tags: [a, '${TAG}']\n"},
+			err:   `argo.yaml: key fields.tags[1]: variable "TAG" is not set`,
+		},
+		{
+			name:  "unterminated reference",
+			files: map[string]string{"argo.yaml": `host: "${HOST"`},
+			err:   `argo.yaml: key host: unterminated variable reference in "${HOST"`,
+		},
+		{
+			name:  "invalid variable name",
+			files: map[string]string{"argo.toml": `host = "${1HOST}"`},
+			err:   `argo.toml: key host: invalid variable name "1HOST"`,
+		},
+		{
+			name:  "json syntax",
+			files: map[string]string{"argo.json": "{\n  \"host\": \"a\",\n}"},
+			err:   "argo.json: line 3: invalid character '}'",
+		},
+		{
+			name:  "included file",
+			files: map[string]string{"argo.json": `{"include_files": ["conf.d/*.yaml"]}`, "conf.d/a.yaml": "a: 1\n a: 2\n"},
+			err:   "conf.d/a.yaml: line 2: mapping values are not allowed in this context",
+		},
+		{
+			name:  "nested include",
+			files: map[string]string{"argo.json": `{"include_files": "conf.d"}`, "conf.d/a.json": `{"include_files": "b.json"}`},
+			err:   "conf.d/a.json: key include_files: only the main configuration file may include files",
+		},
+		{
+			name:  "include type",
+			files: map[string]string{"argo.yaml": "include_files: [1]\n"},
+			err:   "argo.yaml: key include_files[0]: expected a string",
+		},
+		{
+			name:  "not a mapping",
+			files: map[string]string{"argo.yaml": "- a\n"},
+			err:   "argo.yaml: expected a mapping of settings",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, cleanup := writeFiles(t, tt.files)
+			defer cleanup()
+
+			var main string
+			for name := range tt.files {
+				if strings.HasPrefix(name, "argo.") {
+					main = filepath.Join(dir, name)
+				}
+			}
+
+			_, err := Load(main, noEnv)
+			if err == nil || !strings.HasPrefix(strings.TrimPrefix(err.Error(), dir+"/"), tt.err) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	env := testEnv(map[string]string{"A": "a", "EMPTY": ""})
+
+	tests := []struct {
+		in, exp string
+	}{
+		{"${A}", "a"},
+		{"x-${A}-${A}", "x-a-a"},
+		{"${B:-b}", "b"},
+		{"${EMPTY:-e}", "e"},
+		{"${EMPTY}", ""},
+		{"${B:-}", ""},
+		{"$$A ${A:-x}$$", "$A a$"},
+		{"$A $", "$A $"},
+	}
+
+	for _, tt := range tests {
+		s, err := interpolate(tt.in, "k", env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != tt.exp {
+			t.Fatalf("%q: expected %q, got %q", tt.in, tt.exp, s)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package conffile
+
+import (
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/xerrors"
+)
+
+// parseTOML parses a TOML document. Dates and times are kept as strings.
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if _, err := toml.Decode(string(data), &m); err != nil {
+		return nil, xerrors.New(strings.TrimPrefix(err.Error(), "toml: "))
+	}
+	return fromTOML(m).(map[string]interface{}), nil
+}
+
+// fromTOML converts the values of a TOML document to those that JSON decoding would produce.
+func fromTOML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = fromTOML(item)
+		}
+		return v
+	case []map[string]interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = fromTOML(item)
+		}
+		return items
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromTOML(item)
+		}
+		return v
+	case time.Time:
+		return formatTime(v)
+	}
+	return v
+}
+
+// formatTime formats a TOML date or time as it is written, without an offset if it has none.
+func formatTime(t time.Time) string {
+	switch t.Location().String() {
+	case "datetime-local":
+		return t.Format("2006-01-02T15:04:05.999999999")
+	case "date-local":
+		return t.Format("2006-01-02")
+	case "time-local":
+		return t.Format("15:04:05.999999999")
+	}
+	return t.Format(time.RFC3339Nano)
+}
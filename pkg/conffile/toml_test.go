@@ -0,0 +1,88 @@
+package conffile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	in := `# argo
+host = "http://localhost:9200"
+buffer_size = 1_000
+rate = 2.5
+mask = 0x1F
+once = true
+since = 2019-06-09T12:00:00Z
+tags = [
+  "a", # first
+  'b\c',
+]
+fields = { env = "prod", "dc" = "eu-1" }
+http.listen = "127.0.0.1:9700"
+
+[log]
+level = "debug"
+levels.es = "warn"
+
+[[processors]]
+type = "rename"
+from = "a"
+
+[[processors]]
+type = "drop"
+when = """
+level == "debug" \
+  && env == "dev\""""
+`
+
+	exp := map[string]interface{}{
+		"host":        "http://localhost:9200",
+		"buffer_size": int64(1000),
+		"rate":        2.5,
+		"mask":        int64(31),
+		"once":        true,
+		"since":       "2019-06-09T12:00:00Z",
+		"tags":        []interface{}{"a", `b\c`},
+		"fields":      map[string]interface{}{"env": "prod", "dc": "eu-1"},
+		"http":        map[string]interface{}{"listen": "127.0.0.1:9700"},
+		"log": map[string]interface{}{
+			"level":  "debug",
+			"levels": map[string]interface{}{"es": "warn"},
+		},
+		"processors": []interface{}{
+			map[string]interface{}{"type": "rename", "from": "a"},
+			map[string]interface{}{"type": "drop", "when": `level == "debug" && env == "dev"`},
+		},
+	}
+
+	v, err := parseTOML([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, exp) {
+		t.Fatalf("expected %#v, got %#v", exp, v)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{"a = 1\na = 2\n", `line 2 (last key "a"): Key 'a' has already been defined`},
+		{"[log]\n[log]\n", "line 2: "},
+		{"a = \"open\n", `line 1 (last key "a"): strings cannot contain newlines`},
+		{"a = {b = 1}\n[a]\n", "line 2: "},
+		{"a = 1 b = 2\n", "line 1: "},
+		{"\n\na = [1,\n", `line 3 (last key "a"): unexpected EOF`},
+		{"a = 1__0\n", `line 1 (last key "a"): Invalid integer "1__0"`},
+	}
+
+	for _, tt := range tests {
+		_, err := parseTOML([]byte(tt.in))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Fatalf("%q: expected error %q, got %v", tt.in, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package conffile
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// plain is an unquoted YAML scalar, whose type is resolved once its variables are expanded.
+type plain string
+
+// parseYAML parses a single YAML document. Timestamps are kept as strings, and plain scalars with
+// variable references are resolved by expand.
+func parseYAML(data []byte) (interface{}, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+
+	var doc yaml.Node
+	err := dec.Decode(&doc)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, yamlError(err)
+	}
+
+	var next yaml.Node
+	if err := dec.Decode(&next); err != io.EOF {
+		if err != nil {
+			return nil, yamlError(err)
+		}
+		return nil, xerrors.Errorf("line %d: multiple documents are not supported", next.Line)
+	}
+
+	return fromNode(&doc)
+}
+
+// yamlError removes the package prefix of the errors of the YAML decoder.
+func yamlError(err error) error {
+	return xerrors.New(strings.TrimPrefix(err.Error(), "yaml: "))
+}
+
+// fromNode converts a YAML node to the values that JSON decoding would produce.
+func fromNode(n *yaml.Node) (interface{}, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return fromNode(n.Content[0])
+	case yaml.AliasNode:
+		return fromNode(n.Alias)
+	case yaml.SequenceNode:
+		items := make([]interface{}, 0, len(n.Content))
+		for _, c := range n.Content {
+			item, err := fromNode(c)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, c := n.Content[i], n.Content[i+1]
+			if k.Kind != yaml.ScalarNode {
+				return nil, xerrors.Errorf("line %d: keys must be scalars", k.Line)
+			}
+			if _, ok := m[k.Value]; ok {
+				return nil, xerrors.Errorf("line %d: duplicate key %q", k.Line, k.Value)
+			}
+			v, err := fromNode(c)
+			if err != nil {
+				return nil, err
+			}
+			m[k.Value] = v
+		}
+		return m, nil
+	}
+	return scalar(n)
+}
+
+// scalar returns the value of a scalar node, with integers as int64 like the TOML ones.
+func scalar(n *yaml.Node) (interface{}, error) {
+	if n.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+		if strings.Contains(n.Value, "${") {
+			return plain(n.Value), nil
+		}
+		if n.ShortTag() == "!!timestamp" {
+			return n.Value, nil
+		}
+	}
+
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return nil, xerrors.Errorf("line %d: %s", n.Line, strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+	if i, ok := v.(int); ok {
+		return int64(i), nil
+	}
+	return v, nil
+}
+
+// resolve returns the value of a plain scalar once its variables are expanded: null, a boolean,
+// an integer, a float or otherwise the string itself.
+func resolve(s string) interface{} {
+	if strings.Contains(s, "${") {
+		return s
+	}
+	v, err := scalar(&yaml.Node{Kind: yaml.ScalarNode, Value: s})
+	if err != nil {
+		return s
+	}
+	return v
+}
@@ -0,0 +1,150 @@
+package conffile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func noEnv(string) (string, bool) { return "", false }
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		exp  interface{}
+	}{
+		{
+			name: "mapping",
+			in: `# argo
+---
+host: http://localhost:9200
+buffer_size: 100
+rate: 2.5
+once: true
+timeout:
+fields: {env: prod, "dc": 'eu-1'}
+http:
+  listen: "127.0.0.1:9700"   # comment
+  enabled: no
+`,
+			exp: map[string]interface{}{
+				"host":        "http://localhost:9200",
+				"buffer_size": int64(100),
+				"rate":        2.5,
+				"once":        true,
+				"timeout":     nil,
+				"fields":      map[string]interface{}{"env": "prod", "dc": "eu-1"},
+				"http":        map[string]interface{}{"listen": "127.0.0.1:9700", "enabled": "no"},
+			},
+		},
+		{
+			name: "sequences",
+			in: `paths:
+- /var/log/a.log
+- "/var/log/#b.log"
+tags: [a, "b, c", 0x10]
+processors:
+  - type: rename
+    from: a
+  -
+    type: drop
+matrix:
+  - - 1
+    - 2
+  - []
+`,
+			exp: map[string]interface{}{
+				"paths": []interface{}{"/var/log/a.log", "/var/log/#b.log"},
+				"tags":  []interface{}{"a", "b, c", int64(16)},
+				"processors": []interface{}{
+					map[string]interface{}{"type": "rename", "from": "a"},
+					map[string]interface{}{"type": "drop"},
+				},
+				"matrix": []interface{}{[]interface{}{int64(1), int64(2)}, []interface{}{}},
+			},
+		},
+		{
+			name: "block scalars",
+			in: `literal: |
+  first
+    second
+
+folded: >-
+  one
+  two
+
+  three
+keep: |+
+  kept
+
+end: 'it''s'
+`,
+			exp: map[string]interface{}{
+				"literal": "first\n  second\n",
+				"folded":  "one two\nthree",
+				"keep":    "kept\n\n",
+				"end":     "it's",
+			},
+		},
+		{
+			name: "quoted",
+			in:   `a: "tab\there \u00e9 \"q\""` + "\n" + `"b c": '#x'`,
+			exp:  map[string]interface{}{"a": "tab\there é \"q\"", "b c": "#x"},
+		},
+		{
+			name: "anchors",
+			in:   "base: &base {level: info}\nlog: *base\nport: &port 9200\nports: [*port]\n",
+			exp: map[string]interface{}{
+				"base":  map[string]interface{}{"level": "info"},
+				"log":   map[string]interface{}{"level": "info"},
+				"port":  int64(9200),
+				"ports": []interface{}{int64(9200)},
+			},
+		},
+		{
+			name: "empty",
+			in:   "# nothing\n",
+			exp:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := parseYAML([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err = expand(v, "", noEnv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(v, tt.exp) {
+				t.Fatalf("expected %#v, got %#v", tt.exp, v)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		in  string
+		err string
+	}{
+		{"a: 1\n  b: 2\n", "line 2: mapping values are not allowed in this context"},
+		{"a: 1\na: 2\n", `line 2: duplicate key "a"`},
+		{"a:\n\t- b\n", "line 2: found character that cannot start any token"},
+		{"a: [1, 2\n", "line 1: "},
+		{"a: \"open\n", "line 2: found unexpected end of stream"},
+		{"a: 1\n---\nb: 2\n", "line 2: multiple documents are not supported"},
+		{"a: 1\n- b\n", "line 1: did not find expected key"},
+		{"a: *x\n", "unknown anchor 'x' referenced"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseYAML([]byte(tt.in))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+			t.Fatalf("%q: expected error %q, got %v", tt.in, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+// Package expr parses and evaluates boolean conditions over the fields of events, e.g.
+//
+//	level == "debug" && service != "payments"
+//	status >= 500 || message =~ "timeout|refused"
+//	exists(trace.id) && !(user.name == "healthcheck")
+//
+// Fields are dotted paths that are resolved by a Lookup. Comparisons of missing fields are false,
+// except for != and !~ which are true.
+package expr
+
+import (
+	"regexp"
+	"strconv"
+
+	"golang.org/x/xerrors"
+)
+
+// Lookup returns the value of a field and whether it exists.
+type Lookup func(field string) (interface{}, bool)
+
+// Expr is a parsed condition.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parse parses the source of a condition.
+func Parse(src string) (*Expr, error) {
+	p := &parser{lex: newLexer(src)}
+	p.next()
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+
+	return &Expr{src: src, root: root}, nil
+}
+
+// Match evaluates the condition against the fields returned by lookup.
+func (e *Expr) Match(lookup Lookup) bool {
+	return e.root.eval(lookup)
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+type node interface {
+	eval(Lookup) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(l Lookup) bool { return n.left.eval(l) && n.right.eval(l) }
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(l Lookup) bool { return n.left.eval(l) || n.right.eval(l) }
+
+type notNode struct{ node node }
+
+func (n notNode) eval(l Lookup) bool { return !n.node.eval(l) }
+
+type existsNode struct{ field string }
+
+func (n existsNode) eval(l Lookup) bool {
+	_, ok := l(n.field)
+	return ok
+}
+
+// literalNode is a bare true or false.
+type literalNode bool
+
+func (n literalNode) eval(Lookup) bool { return bool(n) }
+
+// operand is either a field or a literal value.
+type operand struct {
+	field string
+	value interface{}
+}
+
+func (o operand) resolve(l Lookup) (interface{}, bool) {
+	if o.field == "" {
+		return o.value, true
+	}
+	return l(o.field)
+}
+
+type compareNode struct {
+	op          string
+	left, right operand
+	re          *regexp.Regexp
+}
+
+func (n compareNode) eval(l Lookup) bool {
+	a, aok := n.left.resolve(l)
+
+	switch n.op {
+	case "=~", "!~":
+		s, ok := a.(string)
+		matched := aok && ok && n.re.MatchString(s)
+		return matched == (n.op == "=~")
+	}
+
+	b, bok := n.right.resolve(l)
+	if !aok || !bok {
+		return n.op == "!="
+	}
+
+	switch n.op {
+	case "==":
+		return equal(a, b)
+	case "!=":
+		return !equal(a, b)
+	}
+
+	cmp, ok := compare(a, b)
+	if !ok {
+		return false
+	}
+
+	switch n.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// equal compares two values, numerically if both are numbers or numeric strings.
+func equal(a, b interface{}) bool {
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			return x == y
+		}
+	}
+
+	switch a := a.(type) {
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	case bool:
+		b, ok := b.(bool)
+		return ok && a == b
+	case nil:
+		return b == nil
+	}
+	return false
+}
+
+// compare orders two values numerically if both are numbers or numeric strings, or
+// lexicographically if both are strings.
+func compare(a, b interface{}) (int, bool) {
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+
+	x, ok := a.(string)
+	if !ok {
+		return 0, false
+	}
+	y, ok := b.(string)
+	if !ok {
+		return 0, false
+	}
+
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	}
+	return 0, true
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+func (p *parser) next() {
+	p.tok = p.lex.next()
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	if p.tok.kind == tokError {
+		return xerrors.Errorf("%s at offset %d", p.tok.text, p.tok.pos)
+	}
+	return xerrors.Errorf(format+" at offset %d", append(args, p.tok.pos)...)
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.tok.kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.tok.kind == tokAnd {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.tok.kind == tokNot {
+		p.next()
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	switch p.tok.kind {
+	case tokLParen:
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("expected ) but found %s", p.tok)
+		}
+		p.next()
+		return n, nil
+
+	case tokIdent:
+		if p.tok.text == "exists" && p.lex.peek() == '(' {
+			return p.parseExists()
+		}
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.kind != tokCompare {
+		if b, ok := left.value.(bool); ok && left.field == "" {
+			return literalNode(b), nil
+		}
+		return nil, p.errorf("expected comparison but found %s", p.tok)
+	}
+	op := p.tok.text
+	p.next()
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	n := compareNode{op: op, left: left, right: right}
+	if op == "=~" || op == "!~" {
+		pattern, ok := right.value.(string)
+		if right.field != "" || !ok {
+			return nil, xerrors.Errorf("%s expects a string pattern", op)
+		}
+
+		n.re, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	return n, nil
+}
+
+func (p *parser) parseExists() (node, error) {
+	p.next()
+	if p.tok.kind != tokLParen {
+		return nil, p.errorf("expected ( but found %s", p.tok)
+	}
+	p.next()
+
+	if p.tok.kind != tokIdent {
+		return nil, p.errorf("expected field but found %s", p.tok)
+	}
+	field := p.tok.text
+	p.next()
+
+	if p.tok.kind != tokRParen {
+		return nil, p.errorf("expected ) but found %s", p.tok)
+	}
+	p.next()
+
+	return existsNode{field}, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	tok := p.tok
+
+	switch tok.kind {
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return operand{value: true}, nil
+		case "false":
+			return operand{value: false}, nil
+		case "null":
+			return operand{value: nil}, nil
+		}
+		return operand{field: tok.text}, nil
+
+	case tokString:
+		p.next()
+		return operand{value: tok.text}, nil
+
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return operand{}, p.errorf("invalid number %s", tok.text)
+		}
+		p.next()
+		return operand{value: f}, nil
+	}
+
+	return operand{}, p.errorf("expected field or value but found %s", tok)
+}
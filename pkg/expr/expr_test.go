@@ -0,0 +1,119 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+)
+
+func lookupIn(fields map[string]interface{}) Lookup {
+	return func(field string) (interface{}, bool) {
+		var v interface{} = fields
+		for _, part := range strings.Split(field, ".") {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[part]; !ok {
+				return nil, false
+			}
+		}
+		return v, true
+	}
+}
+
+func TestMatch(t *testing.T) {
+	fields := map[string]interface{}{
+		"level":   "debug",
+		"service": "api",
+		"status":  503.0,
+		"code":    "404",
+		"ok":      false,
+		"message": "connection refused by upstream",
+		"trace":   map[string]interface{}{"id": "abc"},
+		"user":    nil,
+		"path":    `C:\logs`,
+	}
+
+	var tests = []struct {
+		expr  string
+		match bool
+	}{
+		{`level == "debug" && service != "payments"`, true},
+		{`level == "debug" && service != "api"`, false},
+		{`level == 'info' || status >= 500`, true},
+		{`status > 503`, false},
+		{`status <= 503.0`, true},
+		{`status < 1e3`, true},
+		{`code == 404`, true},
+		{`code > 400 && code < 500`, true},
+		{`status == "503"`, true},
+		{`level < "error"`, true},
+		{`message =~ "timeout|refused"`, true},
+		{`message =~ '^connection\s+refused'`, true},
+		{`message !~ "timeout"`, true},
+		{`missing =~ "x"`, false},
+		{`missing !~ "x"`, true},
+		{`status =~ "503"`, false},
+		{`exists(trace.id)`, true},
+		{`exists(trace.span)`, false},
+		{`exists(user)`, true},
+		{`user == null`, true},
+		{`trace.id == "abc"`, true},
+		{`missing == "x"`, false},
+		{`missing != "x"`, true},
+		{`missing > 1`, false},
+		{`ok == false`, true},
+		{`ok == 0`, false},
+		{`!(level == "debug")`, false},
+		{`!exists(missing) && !!true`, true},
+		{`level == "info" || level == "debug" && status == 200`, false},
+		{`(level == "info" || level == "debug") && status == 503`, true},
+		{`path == "C:\\logs"`, true},
+		{`false || true`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if match := e.Match(lookupIn(fields)); match != tt.match {
+				t.Fatalf("expected %t, got %t", tt.match, match)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	var tests = []struct {
+		expr string
+		err  string
+	}{
+		{``, "expected field or value but found end of expression at offset 0"},
+		{`level`, "expected comparison but found end of expression at offset 5"},
+		{`level == `, "expected field or value but found end of expression at offset 9"},
+		{`level == "debug" &&`, "expected field or value but found end of expression at offset 19"},
+		{`(level == "debug"`, "expected ) but found end of expression at offset 17"},
+		{`level == "debug")`, `unexpected ")" at offset 16`},
+		{`level = "debug"`, "unexpected character '=' at offset 6"},
+		{`level == "debug`, "unterminated string at offset 9"},
+		{`level =~ other`, "=~ expects a string pattern"},
+		{`level =~ "("`, "invalid pattern \"(\": error parsing regexp: missing closing ): `(`"},
+		{`exists(1)`, `expected field but found "1" at offset 7`},
+		{`status > -`, "invalid number - at offset 9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			if err == nil {
+				t.Fatalf("expected error %q", tt.err)
+			}
+			if err.Error() != tt.err {
+				t.Fatalf("expected error %q, got %q", tt.err, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokError
+	tokIdent
+	tokString
+	tokNumber
+	tokCompare
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: src}
+}
+
+// peek returns the next character that is not a space, or zero at the end of the source.
+func (l *lexer) peek() byte {
+	rest := strings.TrimLeftFunc(l.src[l.pos:], unicode.IsSpace)
+	if rest == "" {
+		return 0
+	}
+	return rest[0]
+}
+
+func (l *lexer) next() token {
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		l.pos += size
+	}
+
+	start := l.pos
+	if start >= len(l.src) {
+		return token{kind: tokEOF, pos: start}
+	}
+
+	rest := l.src[start:]
+	for _, op := range []struct {
+		text string
+		kind tokenKind
+	}{
+		{"&&", tokAnd},
+		{"||", tokOr},
+		{"==", tokCompare},
+		{"!=", tokCompare},
+		{"=~", tokCompare},
+		{"!~", tokCompare},
+		{"<=", tokCompare},
+		{">=", tokCompare},
+		{"<", tokCompare},
+		{">", tokCompare},
+		{"!", tokNot},
+		{"(", tokLParen},
+		{")", tokRParen},
+	} {
+		if strings.HasPrefix(rest, op.text) {
+			l.pos += len(op.text)
+			return token{kind: op.kind, text: op.text, pos: start}
+		}
+	}
+
+	c := rest[0]
+	switch {
+	case c == '"' || c == '\'':
+		return l.string(c)
+	case c == '-' || c >= '0' && c <= '9':
+		return l.number()
+	}
+
+	r, size := utf8.DecodeRuneInString(rest)
+	if isIdent(r) {
+		return l.ident()
+	}
+
+	l.pos += size
+	return token{kind: tokError, text: fmt.Sprintf("unexpected character %q", r), pos: start}
+}
+
+// string lexes a quoted string. Double quoted strings support Go escapes, while single quoted
+// ones are raw, which is convenient for regular expressions.
+func (l *lexer) string(quote byte) token {
+	start := l.pos
+
+	for i := start + 1; i < len(l.src); i++ {
+		switch l.src[i] {
+		case '\\':
+			if quote == '"' {
+				i++
+			}
+		case quote:
+			l.pos = i + 1
+			if quote == '\'' {
+				return token{kind: tokString, text: l.src[start+1 : i], pos: start}
+			}
+
+			s, err := strconv.Unquote(l.src[start : i+1])
+			if err != nil {
+				return token{kind: tokError, text: "invalid string " + l.src[start:i+1], pos: start}
+			}
+			return token{kind: tokString, text: s, pos: start}
+		}
+	}
+
+	l.pos = len(l.src)
+	return token{kind: tokError, text: "unterminated string", pos: start}
+}
+
+func (l *lexer) number() token {
+	start := l.pos
+	l.pos++
+
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c != '.' && c != 'e' && c != 'E' && c != '+' && c != '-' && (c < '0' || c > '9') {
+			break
+		}
+		l.pos++
+	}
+	return token{kind: tokNumber, text: l.src[start:l.pos], pos: start}
+}
+
+func (l *lexer) ident() token {
+	start := l.pos
+
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		if !isIdent(r) {
+			break
+		}
+		l.pos += size
+	}
+	return token{kind: tokIdent, text: l.src[start:l.pos], pos: start}
+}
+
+// isIdent reports whether r may appear in a field name; dots separate nested fields.
+func isIdent(r rune) bool {
+	return r == '_' || r == '.' || r == '@' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
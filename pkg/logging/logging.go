@@ -0,0 +1,218 @@
+// Package logging writes leveled, structured log records in the logfmt or JSON format.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/xerrors"
+)
+
+// Level is the severity of a record.
+type Level int
+
+// Levels in increasing severity.
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < DebugLevel || l > ErrorLevel {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level of the specified name.
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return Level(i), nil
+		}
+	}
+	return 0, xerrors.Errorf("unknown level %q, expected one of %s", name, strings.Join(levelNames, ", "))
+}
+
+// Formats of the records.
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+// Formats lists the supported formats.
+var Formats = []string{FormatLogfmt, FormatJSON}
+
+// sink serializes the records of all the loggers derived from the same root.
+type sink struct {
+	sync.Mutex
+
+	w      io.Writer
+	format string
+	levels map[string]Level
+	now    func() time.Time
+}
+
+// Logger writes the records of a component at or above its level, with the fields added by With.
+// A nil Logger discards every record.
+type Logger struct {
+	sink      *sink
+	level     Level
+	component string
+	fields    []interface{}
+}
+
+// New returns a root logger that writes the records at or above level to w in the specified
+// format. Components with an entry in levels use that level instead.
+func New(w io.Writer, format string, level Level, levels map[string]Level) *Logger {
+	return &Logger{
+		sink:  &sink{w: w, format: format, levels: levels, now: time.Now},
+		level: level,
+	}
+}
+
+// Component returns a logger for the named component, which records it in every record and uses
+// its own level if one is configured.
+func (l *Logger) Component(name string) *Logger {
+	if l == nil {
+		return nil
+	}
+	c := *l
+	c.component = name
+	if level, ok := l.sink.levels[name]; ok {
+		c.level = level
+	}
+	return &c
+}
+
+// With returns a logger that adds the specified key value pairs to every record.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+	c := *l
+	c.fields = append(append([]interface{}(nil), l.fields...), kv...)
+	return &c
+}
+
+// Enabled reports whether records of the specified level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level >= l.level
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(DebugLevel, msg, kv) }
+func (l *Logger) Info(msg string, kv ...interface{})  { l.log(InfoLevel, msg, kv) }
+func (l *Logger) Warn(msg string, kv ...interface{})  { l.log(WarnLevel, msg, kv) }
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(ErrorLevel, msg, kv) }
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	s := l.sink
+	s.Lock()
+	defer s.Unlock()
+
+	pairs := make([]interface{}, 0, 8+len(l.fields)+len(kv))
+	pairs = append(pairs, "time", s.now().UTC().Format("2006-01-02T15:04:05.000Z07:00"), "level", level.String())
+	if l.component != "" {
+		pairs = append(pairs, "component", l.component)
+	}
+	pairs = append(pairs, "msg", msg)
+	pairs = append(pairs, l.fields...)
+	pairs = append(pairs, kv...)
+	if len(pairs)%2 != 0 {
+		pairs = append(pairs, "(MISSING)")
+	}
+
+	var buf bytes.Buffer
+	if s.format == FormatJSON {
+		writeJSON(&buf, pairs)
+	} else {
+		writeLogfmt(&buf, pairs)
+	}
+	s.w.Write(buf.Bytes())
+}
+
+func writeLogfmt(buf *bytes.Buffer, pairs []interface{}) {
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(fmt.Sprint(pairs[i]))
+		buf.WriteByte('=')
+
+		v := stringOf(pairs[i+1])
+		if needsQuotes(v) {
+			v = strconv.Quote(v)
+		}
+		buf.WriteString(v)
+	}
+	buf.WriteByte('\n')
+}
+
+func writeJSON(buf *bytes.Buffer, pairs []interface{}) {
+	buf.WriteByte('{')
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(fmt.Sprint(pairs[i]))
+		buf.Write(key)
+		buf.WriteByte(':')
+
+		var value []byte
+		switch v := pairs[i+1].(type) {
+		case nil:
+			value = []byte("null")
+		case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			var err error
+			if value, err = json.Marshal(v); err != nil {
+				// NaN and infinities have no JSON number
+				value, _ = json.Marshal(stringOf(v))
+			}
+		default:
+			value, _ = json.Marshal(stringOf(v))
+		}
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+}
+
+func stringOf(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	case nil:
+		return "null"
+	}
+	return fmt.Sprint(v)
+}
+
+func needsQuotes(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestLogger(format string, level Level, levels map[string]Level) (*Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+
+	l := New(&buf, format, level, levels)
+	l.sink.now = func() time.Time { return time.Date(2019, 6, 9, 12, 0, 0, 0, time.UTC) }
+
+	return l, &buf
+}
+
+func TestLogfmt(t *testing.T) {
+	l, buf := newTestLogger(FormatLogfmt, InfoLevel, nil)
+
+	file := l.Component("file").With("path", "/var/log/my app.log")
+	file.Info("ack received", "offset", 42, "errors", false)
+	file.Error("could not update registry", "error", errors.New(`bucket "argo" not found`), "took", 1500*time.Millisecond)
+	file.Debug("not written")
+	l.Warn("odd", "key")
+
+	exp := `time=2019-06-09T12:00:00.000Z level=info component=file msg="ack received" path="/var/log/my app.log" offset=42 errors=false
+time=2019-06-09T12:00:00.000Z level=error component=file msg="could not update registry" path="/var/log/my app.log" error="bucket \"argo\" not found" took=1.5s
+time=2019-06-09T12:00:00.000Z level=warn msg=odd key=(MISSING)
+`
+	if buf.String() != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, buf.String())
+	}
+}
+
+func TestJSON(t *testing.T) {
+	l, buf := newTestLogger(FormatJSON, DebugLevel, nil)
+
+	l.Component("es").Debug("indexed documents", "indexed", 128, "rate", 2500.5, "error", nil, "hosts", []string{"a", "b"})
+
+	exp := `{"time":"2019-06-09T12:00:00.000Z","level":"debug","component":"es","msg":"indexed documents","indexed":128,"rate":2500.5,"error":null,"hosts":"[a b]"}` + "\n"
+	if buf.String() != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, buf.String())
+	}
+}
+
+func TestComponentLevels(t *testing.T) {
+	l, buf := newTestLogger(FormatLogfmt, InfoLevel, map[string]Level{"file": ErrorLevel, "es": DebugLevel})
+
+	l.Component("file").Warn("silenced")
+	l.Component("es").Debug("written")
+	l.Component("out").Debug("silenced")
+	l.Component("out").Info("written")
+
+	if n := bytes.Count(buf.Bytes(), []byte("\n")); n != 2 || bytes.Contains(buf.Bytes(), []byte("silenced")) {
+		t.Fatalf("expected only the written records, got:\n%s", buf.String())
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+
+	l.Component("file").With("path", "a.log").Error("discarded")
+	if l.Enabled(ErrorLevel) {
+		t.Fatalf("expected a nil logger to be disabled")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, exp := range map[string]Level{"debug": DebugLevel, "INFO": InfoLevel, "Warn": WarnLevel, "error": ErrorLevel} {
+		level, err := ParseLevel(name)
+		if err != nil || level != exp {
+			t.Fatalf("expected %s for %q, got %s and %v", exp, name, level, err)
+		}
+	}
+
+	if _, err := ParseLevel("trace"); err == nil || err.Error() != `unknown level "trace", expected one of debug, info, warn, error` {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
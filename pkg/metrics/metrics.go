@@ -0,0 +1,148 @@
+// Package metrics implements counters, gauges and histograms with labels, exposed in the
+// Prometheus text format. It wraps the Prometheus client with the instruments the process uses.
+package metrics
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+// DefaultBuckets are the upper bounds of histogram buckets suited to latencies in seconds.
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Emit reports a sample of a metric that is collected when the registry is written, with the
+// values of its labels in order.
+type Emit func(value float64, labelValues ...string)
+
+// Registry holds the metrics of a process.
+type Registry struct {
+	reg *prometheus.Registry
+}
+
+func NewRegistry() *Registry {
+	r := new(Registry)
+
+	r.reg = prometheus.NewRegistry()
+
+	return r
+}
+
+// Write writes every metric in the Prometheus text format, sorted by name.
+func (r *Registry) Write(w io.Writer) error {
+	families, err := r.reg.Gather()
+	if err != nil {
+		return err
+	}
+
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler returns an HTTP handler that serves the metrics of the registry.
+func (r *Registry) Handler() http.Handler {
+	return promhttp.HandlerFor(r.reg, promhttp.HandlerOpts{})
+}
+
+// Counter is a value that only increases, such as a number of events.
+type Counter struct {
+	vec *prometheus.CounterVec
+}
+
+// NewCounter registers a counter with the specified label names.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)}
+	r.reg.MustRegister(c.vec)
+	if len(labels) == 0 {
+		// a metric without labels has a single series, which starts at zero
+		c.vec.WithLabelValues()
+	}
+	return c
+}
+
+// Add increases the counter of the label values by delta, which must not be negative.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	c.vec.WithLabelValues(labelValues...).Add(delta)
+}
+
+// Inc increases the counter of the label values by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.vec.WithLabelValues(labelValues...).Inc()
+}
+
+// Gauge is a value that may go up and down, such as a queue depth.
+type Gauge struct {
+	vec *prometheus.GaugeVec
+}
+
+// NewGauge registers a gauge with the specified label names.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)}
+	r.reg.MustRegister(g.vec)
+	if len(labels) == 0 {
+		g.vec.WithLabelValues()
+	}
+	return g
+}
+
+// Set sets the gauge of the label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Set(v)
+}
+
+// Add changes the gauge of the label values by delta.
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Add(delta)
+}
+
+// function is a counter or a gauge whose samples are collected when it is written.
+type function struct {
+	desc    *prometheus.Desc
+	typ     prometheus.ValueType
+	collect func(Emit)
+}
+
+func (f *function) Describe(ch chan<- *prometheus.Desc) {
+	ch <- f.desc
+}
+
+func (f *function) Collect(ch chan<- prometheus.Metric) {
+	f.collect(func(value float64, values ...string) {
+		ch <- prometheus.MustNewConstMetric(f.desc, f.typ, value, values...)
+	})
+}
+
+// NewCounterFunc registers a counter that is collected by calling collect on every write.
+func (r *Registry) NewCounterFunc(name, help string, labels []string, collect func(Emit)) {
+	r.reg.MustRegister(&function{prometheus.NewDesc(name, help, labels, nil), prometheus.CounterValue, collect})
+}
+
+// NewGaugeFunc registers a gauge that is collected by calling collect on every write.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func(Emit)) {
+	r.reg.MustRegister(&function{prometheus.NewDesc(name, help, labels, nil), prometheus.GaugeValue, collect})
+}
+
+// Histogram counts observations, such as latencies, in buckets.
+type Histogram struct {
+	vec *prometheus.HistogramVec
+}
+
+// NewHistogram registers a histogram with the specified bucket upper bounds, in increasing order,
+// and label names. An implicit +Inf bucket holds every observation.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)}
+	r.reg.MustRegister(h.vec)
+	return h
+}
+
+// Observe adds an observation to the histogram of the label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.vec.WithLabelValues(labelValues...).Observe(v)
+}
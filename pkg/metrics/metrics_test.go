@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+
+	events := r.NewCounter("events_total", "Events sent.", "source")
+	events.Add(3, "b.log")
+	events.Inc("a.log")
+	events.Inc(`c"\.log`)
+
+	queue := r.NewGauge("queue_depth", "Batches queued\nfor the output.")
+	queue.Set(4)
+	queue.Add(-1)
+
+	r.NewGaugeFunc("file_size_bytes", "Size of the file.", []string{"source"}, func(emit Emit) {
+		emit(1024, "a.log")
+	})
+
+	latency := r.NewHistogram("latency_seconds", "Request latency.", []float64{0.1, 1}, "op")
+	latency.Observe(0.05, "put")
+	latency.Observe(0.1, "put")
+	latency.Observe(0.5, "put")
+	latency.Observe(2, "put")
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `# HELP events_total Events sent.
+# TYPE events_total counter
+events_total{source="a.log"} 1.0
+events_total{source="b.log"} 3.0
+events_total{source="c\"\\.log"} 1.0
+# HELP file_size_bytes Size of the file.
+# TYPE file_size_bytes gauge
+file_size_bytes{source="a.log"} 1024.0
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="put",le="0.1"} 2.0
+latency_seconds_bucket{op="put",le="1.0"} 3.0
+latency_seconds_bucket{op="put",le="+Inf"} 4.0
+latency_seconds_sum{op="put"} 2.65
+latency_seconds_count{op="put"} 4.0
+# HELP queue_depth Batches queued\nfor the output.
+# TYPE queue_depth gauge
+queue_depth 3.0
+`
+	if buf.String() != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, buf.String())
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 4 || families["latency_seconds"].GetMetric()[0].GetHistogram().GetSampleCount() != 4 {
+		t.Fatalf("unexpected metric families %v", families)
+	}
+}
+
+func TestRegistryHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("up_total", "Starts.").Inc()
+	r.NewCounter("restarts_total", "Restarts.")
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if body := rec.Body.String(); body != "# HELP restarts_total Restarts.\n# TYPE restarts_total counter\nrestarts_total 0.0\n"+
+		"# HELP up_total Starts.\n# TYPE up_total counter\nup_total 1.0\n" {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("events_total", "Events.", "source")
+
+	for name, f := range map[string]func(){
+		"duplicate":    func() { r.NewGauge("events_total", "Events.") },
+		"label values": func() { c.Inc() },
+		"decrease":     func() { c.Add(-1, "a.log") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected %s to panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
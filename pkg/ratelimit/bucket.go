@@ -0,0 +1,73 @@
+// Package ratelimit limits the rate of events with token buckets.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket that refills at a constant rate up to its capacity. It starts full, so
+// that a burst of up to capacity tokens passes at once.
+type Bucket struct {
+	sync.Mutex
+
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
+}
+
+// NewBucket returns a bucket that refills rate tokens per second up to capacity.
+func NewBucket(rate, capacity float64) *Bucket {
+	b := new(Bucket)
+
+	b.rate = rate
+	b.capacity = capacity
+	b.tokens = capacity
+	b.now = time.Now
+	b.last = b.now()
+
+	return b
+}
+
+// Take removes n tokens and reports whether they were available. Requests larger than the
+// capacity pass once the bucket is full, instead of never.
+func (b *Bucket) Take(n float64) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	b.refill()
+	if b.tokens < math.Min(n, b.capacity) {
+		return false
+	}
+
+	b.tokens -= n
+	return true
+}
+
+// Reserve removes n tokens, borrowing from future refills if they are not available, and returns
+// how long the caller should wait until the borrowed tokens have been refilled.
+func (b *Bucket) Reserve(n float64) time.Duration {
+	b.Lock()
+	defer b.Unlock()
+
+	b.refill()
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *Bucket) refill() {
+	now := b.now()
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+
+	if elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+	}
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestBucket(rate, capacity float64) (*Bucket, *clock) {
+	c := &clock{t: time.Date(2019, 6, 9, 0, 0, 0, 0, time.UTC)}
+
+	b := NewBucket(rate, capacity)
+	b.now = c.now
+	b.last = c.now()
+
+	return b, c
+}
+
+func TestBucketTake(t *testing.T) {
+	b, c := newTestBucket(10, 5)
+
+	for i := 0; i < 5; i++ {
+		if !b.Take(1) {
+			t.Fatalf("expected token %d of the burst", i)
+		}
+	}
+	if b.Take(1) {
+		t.Fatal("expected the bucket to be empty")
+	}
+
+	c.advance(100 * time.Millisecond)
+	if !b.Take(1) {
+		t.Fatal("expected a refilled token")
+	}
+	if b.Take(1) {
+		t.Fatal("expected the bucket to be empty")
+	}
+
+	// the bucket does not fill past its capacity
+	c.advance(10 * time.Second)
+	if !b.Take(5) || b.Take(1) {
+		t.Fatal("expected the bucket to hold its capacity")
+	}
+
+	// larger requests than the capacity pass when full
+	c.advance(time.Second)
+	if !b.Take(20) {
+		t.Fatal("expected a large request to pass a full bucket")
+	}
+	c.advance(time.Second)
+	if b.Take(1) {
+		t.Fatal("expected the large request to have been paid back first")
+	}
+}
+
+func TestBucketReserve(t *testing.T) {
+	b, c := newTestBucket(10, 10)
+
+	if wait := b.Reserve(10); wait != 0 {
+		t.Fatalf("expected no wait, got %s", wait)
+	}
+	if wait := b.Reserve(5); wait != 500*time.Millisecond {
+		t.Fatalf("expected 500ms wait, got %s", wait)
+	}
+
+	c.advance(500 * time.Millisecond)
+	if wait := b.Reserve(1); wait != 100*time.Millisecond {
+		t.Fatalf("expected 100ms wait, got %s", wait)
+	}
+}
@@ -1,14 +1,15 @@
 package registry
 
 import (
+	"crypto/rand"
 	"fmt"
-	"log"
-	"os"
 	"strconv"
 	"time"
 
 	bolt "go.etcd.io/bbolt"
 	"golang.org/x/xerrors"
+
+	"github.com/mresvanis/argo/pkg/logging"
 )
 
 var (
@@ -31,23 +32,48 @@ type Registrar interface {
 	// UpdateOffset updates the offset for the specified key or returns
 	// an error on failure.
 	UpdateOffset(key string, offset int64) error
+
+	// GetFingerprint returns the stored content fingerprint for the specified key, or an empty
+	// string if none is stored.
+	GetFingerprint(key string) (string, error)
+
+	// UpdateFingerprint stores the content fingerprint for the specified key or returns an error
+	// on failure.
+	UpdateFingerprint(key string, fingerprint string) error
+
+	// IsComplete reports whether the specified key has been harvested to completion.
+	IsComplete(key string) (bool, error)
+
+	// MarkComplete records that the specified key has been harvested to completion, so
+	// that it is never read again.
+	MarkComplete(key string) error
+
+	// AgentID returns the identifier of this agent, generating and storing it on first use so
+	// that it survives restarts.
+	AgentID() (string, error)
 }
 
 type Registry struct {
 	db   *bolt.DB
-	log  *log.Logger
+	log  *logging.Logger
 	path string
 	term chan struct{}
 
-	bucketName []byte
+	bucketName            []byte
+	completeBucketName    []byte
+	fingerprintBucketName []byte
+	agentBucketName       []byte
 }
 
-func NewRegistry(path string) Registrar {
+func NewRegistry(path string, log *logging.Logger) Registrar {
 	reg := new(Registry)
 
 	reg.path = path
 	reg.bucketName = []byte("argo")
-	reg.log = log.New(os.Stderr, fmt.Sprintf("[reg] %s ", reg.path), log.LstdFlags)
+	reg.completeBucketName = []byte("argo.complete")
+	reg.fingerprintBucketName = []byte("argo.fingerprint")
+	reg.agentBucketName = []byte("argo.agent")
+	reg.log = log.With("registry", path)
 
 	return reg
 }
@@ -59,6 +85,7 @@ func (reg *Registry) Open() error {
 	}
 
 	reg.db = db
+	reg.log.Debug("opened registry")
 
 	return nil
 }
@@ -109,3 +136,120 @@ func (reg *Registry) UpdateOffset(skey string, offset int64) error {
 
 	return err
 }
+
+func (reg *Registry) GetFingerprint(key string) (string, error) {
+	var value string
+
+	err := reg.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(reg.fingerprintBucketName)
+		if bucket == nil {
+			return nil
+		}
+
+		value = string(bucket.Get([]byte(key)))
+		return nil
+	})
+	if err != nil {
+		return "", xerrors.Errorf("%w: %s", ErrGet, err.Error())
+	}
+
+	return value, nil
+}
+
+func (reg *Registry) UpdateFingerprint(skey string, fingerprint string) error {
+	key := []byte(skey)
+	value := []byte(fingerprint)
+
+	return reg.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(reg.fingerprintBucketName)
+		if err != nil {
+			return xerrors.Errorf("%w: %s", ErrUpdate, err.Error())
+		}
+
+		err = bucket.Put(key, value)
+		if err != nil {
+			return xerrors.Errorf("%w: %s", ErrUpdate, err.Error())
+		}
+		return nil
+	})
+}
+
+func (reg *Registry) IsComplete(key string) (bool, error) {
+	var complete bool
+
+	err := reg.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(reg.completeBucketName)
+		if bucket == nil {
+			return nil
+		}
+
+		complete = bucket.Get([]byte(key)) != nil
+		return nil
+	})
+	if err != nil {
+		return false, xerrors.Errorf("%w: %s", ErrGet, err.Error())
+	}
+
+	return complete, nil
+}
+
+func (reg *Registry) MarkComplete(skey string) error {
+	key := []byte(skey)
+	value := []byte(time.Now().UTC().Format(time.RFC3339))
+
+	return reg.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(reg.completeBucketName)
+		if err != nil {
+			return xerrors.Errorf("%w: %s", ErrUpdate, err.Error())
+		}
+
+		err = bucket.Put(key, value)
+		if err != nil {
+			return xerrors.Errorf("%w: %s", ErrUpdate, err.Error())
+		}
+		return nil
+	})
+}
+
+func (reg *Registry) AgentID() (string, error) {
+	var id string
+
+	err := reg.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(reg.agentBucketName)
+		if err != nil {
+			return xerrors.Errorf("%w: %s", ErrUpdate, err.Error())
+		}
+
+		if val := bucket.Get([]byte("id")); val != nil {
+			id = string(val)
+			return nil
+		}
+
+		id, err = newUUID()
+		if err != nil {
+			return xerrors.Errorf("%w: %s", ErrUpdate, err.Error())
+		}
+
+		err = bucket.Put([]byte("id"), []byte(id))
+		if err != nil {
+			return xerrors.Errorf("%w: %s", ErrUpdate, err.Error())
+		}
+		reg.log.Info("generated agent id", "id", id)
+		return nil
+	})
+
+	return id, err
+}
+
+// newUUID returns a random, version 4 UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
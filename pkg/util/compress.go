@@ -0,0 +1,73 @@
+package util
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/xerrors"
+)
+
+// Compression identifies the compression format of a file.
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return "none"
+}
+
+// CompressionOf returns the compression format of the specified path, based on its extension.
+func CompressionOf(path string) Compression {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz":
+		return CompressionGzip
+	case ".zst":
+		return CompressionZstd
+	}
+	return CompressionNone
+}
+
+// NewDecompressor wraps r with a reader that decompresses the specified format.
+func NewDecompressor(r io.Reader, c Compression) (io.ReadCloser, error) {
+	switch c {
+	case CompressionGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, xerrors.Errorf("could not read gzip header: %w", err)
+		}
+		return gr, nil
+
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, xerrors.Errorf("could not read zstd stream: %w", err)
+		}
+		return zstdReadCloser{zr}, nil
+	}
+
+	return ioutil.NopCloser(r), nil
+}
+
+// zstdReadCloser adapts zstd.Decoder, whose Close does not return an error, to io.ReadCloser.
+type zstdReadCloser struct {
+	*zstd.Decoder
+}
+
+func (z zstdReadCloser) Close() error {
+	z.Decoder.Close()
+	return nil
+}
@@ -0,0 +1,124 @@
+package util
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/xerrors"
+)
+
+// Encoding describes how the lines of a file are delimited and transcoded to UTF-8.
+type Encoding struct {
+	Name string
+
+	newline []byte
+	cr      []byte
+	bom     []byte
+	charset encoding.Encoding // nil for UTF-8, which needs no transcoding
+}
+
+var (
+	utf8Encoding = Encoding{
+		Name:    "utf-8",
+		newline: []byte{'\n'},
+		cr:      []byte{'\r'},
+		bom:     []byte{0xef, 0xbb, 0xbf},
+	}
+	utf16leEncoding = Encoding{
+		Name:    "utf-16le",
+		newline: []byte{'\n', 0},
+		cr:      []byte{'\r', 0},
+		bom:     []byte{0xff, 0xfe},
+		charset: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	}
+	utf16beEncoding = Encoding{
+		Name:    "utf-16be",
+		newline: []byte{0, '\n'},
+		cr:      []byte{0, '\r'},
+		bom:     []byte{0xfe, 0xff},
+		charset: unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	}
+
+	encodings = map[string]Encoding{
+		"utf-8":        utf8Encoding,
+		"utf-16":       utf16leEncoding,
+		"utf-16le":     utf16leEncoding,
+		"utf-16be":     utf16beEncoding,
+		"latin-1":      singleByteEncoding("latin-1", charmap.ISO8859_1),
+		"iso-8859-1":   singleByteEncoding("iso-8859-1", charmap.ISO8859_1),
+		"windows-1252": singleByteEncoding("windows-1252", charmap.Windows1252),
+		"shift-jis":    singleByteEncoding("shift-jis", japanese.ShiftJIS),
+	}
+)
+
+// singleByteEncoding returns an encoding whose newline is the ASCII one; this also holds for
+// Shift JIS, whose multi-byte sequences never contain ASCII control bytes.
+func singleByteEncoding(name string, charset encoding.Encoding) Encoding {
+	return Encoding{
+		Name:    name,
+		newline: []byte{'\n'},
+		cr:      []byte{'\r'},
+		charset: charset,
+	}
+}
+
+// LookupEncoding returns the encoding with the specified name, case-insensitively. An empty name
+// returns UTF-8.
+func LookupEncoding(name string) (Encoding, error) {
+	if name == "" {
+		return utf8Encoding, nil
+	}
+
+	enc, ok := encodings[strings.ToLower(name)]
+	if !ok {
+		return Encoding{}, xerrors.Errorf("unsupported encoding %q", name)
+	}
+	return enc, nil
+}
+
+// detectBOM returns the encoding indicated by the byte order mark at the start of head along
+// with the length of the mark; a UTF-16 mark overrides the configured byte order. It returns
+// false if head is too short to tell.
+func (enc Encoding) detectBOM(head []byte) (Encoding, int, bool) {
+	candidates := []Encoding{enc}
+	if enc.Name == utf16leEncoding.Name || enc.Name == utf16beEncoding.Name {
+		candidates = []Encoding{utf16leEncoding, utf16beEncoding}
+	}
+
+	for _, c := range candidates {
+		if len(c.bom) == 0 {
+			continue
+		}
+		if bytes.HasPrefix(head, c.bom) {
+			return c, len(c.bom), true
+		}
+		if bytes.HasPrefix(c.bom, head) {
+			return enc, 0, false
+		}
+	}
+
+	return enc, 0, true
+}
+
+// WithBOM returns the encoding indicated by a byte order mark at the start of a file, for
+// readers that do not start reading from it.
+func (enc Encoding) WithBOM(head []byte) Encoding {
+	e, _, _ := enc.detectBOM(head)
+	return e
+}
+
+func (enc Encoding) decode(b []byte) string {
+	if enc.charset == nil {
+		return string(b)
+	}
+
+	s, err := enc.charset.NewDecoder().Bytes(b)
+	if err != nil {
+		return string(b)
+	}
+	return string(s)
+}
@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"io"
 	"os"
-	"time"
 
 	"golang.org/x/xerrors"
 )
@@ -15,46 +14,168 @@ func IsFileTruncated(file *os.File, offset int64) bool {
 	return info.Size() < offset
 }
 
-func Readline(r *bufio.Reader, b *bytes.Buffer, t time.Duration) (*string, int, error) {
-	var isPartial bool = true
-	var newlineLength int = 1
+// LineReader reads newline-terminated lines, keeping at most a maximum number of bytes of each
+// line in memory. Longer lines are truncated, while their full size is still consumed. Lines are
+// split on the newline of the source encoding and transcoded to UTF-8, so that the sizes returned
+// always refer to the raw bytes.
+type LineReader struct {
+	r   *bufio.Reader
+	buf bytes.Buffer
+	max int
 
-	startTime := time.Now()
+	configured Encoding
+	enc        Encoding
+	detectBOM  bool
+	skip       int // bytes of a byte order mark at the start of the current line
 
-	for {
-		segment, err := r.ReadBytes('\n')
+	size int    // raw bytes consumed for the current line
+	tail []byte // last raw bytes consumed, to detect newlines split across segments
+}
 
-		if segment != nil && len(segment) > 0 {
-			if segment[len(segment)-1] == '\n' {
-				isPartial = false
+// NewLineReader returns a LineReader that keeps up to max bytes of each line; a non-positive max
+// keeps whole lines.
+func NewLineReader(r io.Reader, max int, enc Encoding) *LineReader {
+	lr := new(LineReader)
 
-				if len(segment) > 1 && segment[len(segment)-2] == '\r' {
-					newlineLength++
-				}
-			}
+	lr.r = bufio.NewReaderSize(r, 16<<10) // 16kb buffer by default
+	lr.max = max
+	lr.configured = enc
+	lr.enc = enc
+	lr.tail = make([]byte, 0, 4)
+
+	return lr
+}
+
+// Reset discards any partial line and reads from r.
+func (lr *LineReader) Reset(r io.Reader) {
+	lr.r.Reset(r)
+	lr.reset()
+}
+
+// DetectBOM makes the reader look for a byte order mark before the next line, for readers
+// positioned at the start of a file. The mark is excluded from the line text and may override
+// the byte order of the configured encoding.
+func (lr *LineReader) DetectBOM() {
+	lr.enc = lr.configured
+	lr.detectBOM = true
+}
+
+func (lr *LineReader) reset() {
+	lr.buf.Reset()
+	lr.size = 0
+	lr.skip = 0
+	lr.tail = lr.tail[:0]
+}
+
+// Readline returns the next line without its newline, the raw bytes consumed for it and whether
+// it was truncated. At EOF it returns an error wrapping io.EOF and keeps any partial line, to be
+// completed by a later call once more data has been written.
+func (lr *LineReader) Readline() (*string, int, bool, error) {
+	if lr.detectBOM {
+		head, _ := lr.r.Peek(4)
+
+		enc, skip, ok := lr.enc.detectBOM(head)
+		if !ok {
+			return nil, 0, false, xerrors.Errorf("read partial line: %w", io.EOF)
+		}
+		lr.enc, lr.skip = enc, skip
+		lr.detectBOM = false
+	}
 
-			b.Write(segment)
+	for {
+		var err error
+
+		if lr.awaitingNewline() {
+			var b byte
+			b, err = lr.r.ReadByte()
+			if err == nil {
+				lr.write([]byte{b})
+			}
+		} else {
+			var segment []byte
+			segment, err = lr.r.ReadSlice('\n')
+			lr.write(segment)
 		}
 
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			return nil, 0, false, xerrors.Errorf("read partial line: %w", err)
+		}
 		if err != nil {
-			if err == io.EOF && isPartial {
-				time.Sleep(1 * time.Second)
+			return nil, 0, false, xerrors.Errorf("read error: %w", err)
+		}
 
-				if time.Since(startTime) > t {
-					return nil, 0, xerrors.Errorf("read timeout: %w", err)
-				}
-				continue
+		nl := lr.enc.newline
+		if lr.size%len(nl) == 0 && bytes.HasSuffix(lr.tail, nl) {
+			length := lr.size - len(nl)
+			if bytes.HasSuffix(lr.tail[:len(lr.tail)-len(nl)], lr.enc.cr) {
+				length -= len(lr.enc.cr)
 			}
 
-			return nil, 0, xerrors.Errorf("read error: %w", err)
+			text, size, truncated := lr.line(length)
+			return text, size, truncated, nil
 		}
+	}
+}
+
+// Flush returns the partial line read so far, for files that will not be written to again.
+func (lr *LineReader) Flush() (*string, int, bool) {
+	if lr.size == 0 {
+		return nil, 0, false
+	}
+	return lr.line(lr.size)
+}
+
+// awaitingNewline reports whether the line ends with the first byte of a multi-byte newline, in
+// which case only the next byte is read to complete it.
+func (lr *LineReader) awaitingNewline() bool {
+	nl := lr.enc.newline
+	return len(nl) > 1 && nl[0] == '\n' && lr.size%len(nl) == 1 && bytes.HasSuffix(lr.tail, nl[:1])
+}
+
+func (lr *LineReader) write(segment []byte) {
+	if len(segment) == 0 {
+		return
+	}
 
-		if !isPartial {
-			bufferSize := b.Len()
-			str := new(string)
-			*str = b.String()[:bufferSize-newlineLength]
-			b.Reset()
-			return str, bufferSize, nil
+	if room := lr.max + lr.skip - lr.buf.Len(); lr.max <= 0 || room >= len(segment) {
+		lr.buf.Write(segment)
+	} else if room > 0 {
+		lr.buf.Write(segment[:room])
+	}
+
+	if len(segment) >= cap(lr.tail) {
+		lr.tail = append(lr.tail[:0], segment[len(segment)-cap(lr.tail):]...)
+	} else {
+		if overflow := len(lr.tail) + len(segment) - cap(lr.tail); overflow > 0 {
+			lr.tail = append(lr.tail[:0], lr.tail[overflow:]...)
 		}
+		lr.tail = append(lr.tail, segment...)
+	}
+
+	lr.size += len(segment)
+}
+
+func (lr *LineReader) line(length int) (*string, int, bool) {
+	length -= lr.skip
+	truncated := lr.max > 0 && length > lr.max
+
+	kept := lr.buf.Bytes()
+	if len(kept) > lr.skip {
+		kept = kept[lr.skip:]
+	} else {
+		kept = nil
+	}
+	if len(kept) > length {
+		kept = kept[:length]
 	}
+
+	str := new(string)
+	*str = lr.enc.decode(kept)
+	size := lr.size
+
+	lr.reset()
+	return str, size, truncated
 }
@@ -0,0 +1,12 @@
+package util
+
+import "fmt"
+
+// Key identifies the underlying file regardless of its current path, so it survives renames. On
+// platforms without inodes it is the path of the file.
+func (fs FileState) Key() string {
+	if fs.Inode == 0 && fs.Source != nil {
+		return *fs.Source
+	}
+	return fmt.Sprintf("%d:%d", fs.Device, fs.Inode)
+}
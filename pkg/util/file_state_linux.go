@@ -1,8 +1,25 @@
 package util
 
+import (
+	"os"
+	"syscall"
+)
+
 type FileState struct {
 	Source *string `json:"source,omitempty"`
 	Offset int64   `json:"offset,omitempty"`
 	Inode  uint64  `json:"inode,omitempty"`
 	Device uint64  `json:"device,omitempty"`
 }
+
+// NewFileState returns the state of the file described by info at the specified offset.
+func NewFileState(source *string, offset int64, info os.FileInfo) FileState {
+	fs := FileState{Source: source, Offset: offset}
+
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		fs.Inode = st.Ino
+		fs.Device = st.Dev
+	}
+
+	return fs
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package util
+
+import "os"
+
+// FileState holds the path and offset of a file. The platform exposes no inode, so files are only
+// identified by their path.
+type FileState struct {
+	Source *string `json:"source,omitempty"`
+	Offset int64   `json:"offset,omitempty"`
+	Inode  uint64  `json:"inode,omitempty"`
+	Device uint64  `json:"device,omitempty"`
+}
+
+// NewFileState returns the state of the file described by info at the specified offset.
+func NewFileState(source *string, offset int64, info os.FileInfo) FileState {
+	return FileState{Source: source, Offset: offset}
+}
@@ -0,0 +1,104 @@
+package util
+
+import (
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"golang.org/x/xerrors"
+)
+
+// encodeUTF16 encodes s in UTF-16 with the specified byte order, prefixed by bom.
+func encodeUTF16(s string, order binary.ByteOrder, bom []byte) string {
+	b := append([]byte{}, bom...)
+	for _, u := range utf16.Encode([]rune(s)) {
+		unit := make([]byte, 2)
+		order.PutUint16(unit, u)
+		b = append(b, unit...)
+	}
+	return string(b)
+}
+
+type line struct {
+	text      string
+	size      int
+	truncated bool
+}
+
+func TestLineReaderReadline(t *testing.T) {
+	var tests = []struct {
+		name     string
+		encoding string
+		input    string
+		max      int
+		lines    []line
+		partial  string
+	}{
+		{"lf", "", "a\nbc\n", 0, []line{{"a", 2, false}, {"bc", 3, false}}, ""},
+		{"crlf", "", "a\r\nbc\r\n", 0, []line{{"a", 3, false}, {"bc", 4, false}}, ""},
+		{"empty", "", "\n\r\n", 0, []line{{"", 1, false}, {"", 2, false}}, ""},
+		{"partial", "", "a\nbc", 0, []line{{"a", 2, false}}, "bc"},
+		{"truncated", "", "abcdef\nab\n", 3, []line{{"abc", 7, true}, {"ab", 3, false}}, ""},
+		{"truncated crlf", "", "abc\r\nabcd\r\n", 3, []line{{"abc", 5, false}, {"abc", 6, true}}, ""},
+		{"utf-8 bom", "utf-8", "\xef\xbb\xbfa\nb\n", 0, []line{{"a", 5, false}, {"b", 2, false}}, ""},
+		{"utf-16le", "utf-16le", encodeUTF16("aĊ\r\nb\n", binary.LittleEndian, nil), 0, []line{{"aĊ", 8, false}, {"b", 4, false}}, ""},
+		{"utf-16le bom", "utf-16", encodeUTF16("a\nb\n", binary.LittleEndian, []byte{0xff, 0xfe}), 0, []line{{"a", 6, false}, {"b", 4, false}}, ""},
+		{"utf-16be bom", "utf-16le", encodeUTF16("a\nb\n", binary.BigEndian, []byte{0xfe, 0xff}), 0, []line{{"a", 6, false}, {"b", 4, false}}, ""},
+		{"utf-16be partial", "utf-16be", encodeUTF16("a\nbc", binary.BigEndian, nil), 0, []line{{"a", 4, false}}, "bc"},
+		{"latin-1", "latin-1", "caf\xe9\n", 0, []line{{"café", 5, false}}, ""},
+		{"windows-1252", "windows-1252", "\x80 5\n", 0, []line{{"€ 5", 4, false}}, ""},
+		{"shift-jis", "shift-jis", "\x82\xa0\x0d\x0a", 0, []line{{"あ", 4, false}}, ""},
+		{"giant", "", strings.Repeat("x", 100<<10) + "\nab\n", 4, []line{{"xxxx", 100<<10 + 1, true}, {"ab", 3, false}}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := LookupEncoding(tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			lr := NewLineReader(strings.NewReader(tt.input), tt.max, enc)
+			lr.DetectBOM()
+
+			var lines []line
+			for {
+				text, size, truncated, err := lr.Readline()
+				if xerrors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				lines = append(lines, line{*text, size, truncated})
+			}
+
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Fatalf("expected lines %v, got %v", tt.lines, lines)
+			}
+
+			partial, _, _ := lr.Flush()
+			if tt.partial == "" && partial != nil || tt.partial != "" && (partial == nil || *partial != tt.partial) {
+				t.Fatalf("expected partial line %q, got %v", tt.partial, partial)
+			}
+		})
+	}
+}
+
+func TestLineReaderBounded(t *testing.T) {
+	lr := NewLineReader(strings.NewReader(strings.Repeat("x", 1<<20)+"\n"), 1024, utf8Encoding)
+
+	_, size, truncated, err := lr.Readline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 1<<20+1 || !truncated {
+		t.Fatalf("expected a truncated line of %d bytes, got %d bytes (truncated: %t)", 1<<20+1, size, truncated)
+	}
+	if lr.buf.Cap() > 64<<10 {
+		t.Fatalf("expected bounded buffer, got capacity %d", lr.buf.Cap())
+	}
+}
@@ -0,0 +1,54 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// Fingerprint identifies the content of a file by the hash of its first Size bytes.
+type Fingerprint struct {
+	Size int64
+	Hash string
+}
+
+// NewFingerprint hashes the first size bytes of r.
+func NewFingerprint(r io.ReaderAt, size int64) (Fingerprint, error) {
+	h := sha256.New()
+
+	_, err := io.Copy(h, io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return Fingerprint{}, xerrors.Errorf("could not fingerprint file: %w", err)
+	}
+
+	return Fingerprint{Size: size, Hash: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// ParseFingerprint parses a fingerprint formatted with String.
+func ParseFingerprint(s string) (Fingerprint, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return Fingerprint{}, xerrors.Errorf("invalid fingerprint %q", s)
+	}
+
+	size, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Fingerprint{}, xerrors.Errorf("invalid fingerprint size %q: %w", parts[0], err)
+	}
+
+	return Fingerprint{Size: size, Hash: parts[1]}, nil
+}
+
+func (fp Fingerprint) String() string {
+	return fmt.Sprintf("%d:%s", fp.Size, fp.Hash)
+}
+
+// IsZero reports whether the fingerprint covers no content.
+func (fp Fingerprint) IsZero() bool {
+	return fp.Size == 0
+}
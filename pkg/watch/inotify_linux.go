@@ -0,0 +1,196 @@
+package watch
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/xerrors"
+
+	"github.com/mresvanis/argo/pkg/logging"
+)
+
+const (
+	fileMask = syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_MOVE_SELF | syscall.IN_DELETE_SELF
+	dirMask  = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_MOVE_SELF | syscall.IN_DELETE_SELF
+)
+
+// Inotify is a Watcher backed by the Linux inotify API. Paths that cannot be watched with inotify,
+// e.g. because they do not exist yet or the watch limit has been reached, are polled instead.
+type Inotify struct {
+	sync.Mutex
+
+	fd     int
+	file   *os.File
+	log    *logging.Logger
+	poller *Poller
+
+	watches map[string]*inotifyWatch
+	paths   map[int32][]string
+}
+
+type inotifyWatch struct {
+	wd int32
+	ch chan Op
+}
+
+func newWatcher(interval time.Duration, log *logging.Logger) Watcher {
+	w, err := NewInotify(interval, log)
+	if err != nil {
+		log.Warn("falling back to polling", "error", err)
+		return NewPoller(interval)
+	}
+	return w
+}
+
+// NewInotify returns an inotify Watcher that polls every interval the paths it cannot watch.
+func NewInotify(interval time.Duration, log *logging.Logger) (*Inotify, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, xerrors.Errorf("could not initialize inotify: %w", err)
+	}
+
+	w := new(Inotify)
+
+	w.fd = fd
+	w.file = os.NewFile(uintptr(fd), "inotify")
+	w.log = log
+	w.poller = NewPoller(interval)
+	w.watches = make(map[string]*inotifyWatch)
+	w.paths = make(map[int32][]string)
+
+	go w.read()
+
+	return w, nil
+}
+
+func (w *Inotify) Watch(path string) (<-chan Op, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return w.poller.Watch(path)
+		}
+		return nil, err
+	}
+
+	var mask uint32 = fileMask
+	if info.IsDir() {
+		mask = dirMask
+	}
+
+	wd, err := syscall.InotifyAddWatch(w.fd, path, mask|syscall.IN_MASK_ADD)
+	if err != nil {
+		w.log.Warn("polling path", "path", path, "error", err)
+		return w.poller.Watch(path)
+	}
+
+	iw := &inotifyWatch{wd: int32(wd), ch: make(chan Op, 1)}
+
+	w.Lock()
+	w.watches[path] = iw
+	w.paths[iw.wd] = append(w.paths[iw.wd], path)
+	w.Unlock()
+
+	return iw.ch, nil
+}
+
+func (w *Inotify) Unwatch(path string) {
+	w.Lock()
+	defer w.Unlock()
+
+	iw, ok := w.watches[path]
+	if !ok {
+		w.poller.Unwatch(path)
+		return
+	}
+	delete(w.watches, path)
+
+	paths := w.paths[iw.wd][:0]
+	for _, p := range w.paths[iw.wd] {
+		if p != path {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) > 0 {
+		w.paths[iw.wd] = paths
+		return
+	}
+
+	delete(w.paths, iw.wd)
+	syscall.InotifyRmWatch(w.fd, uint32(iw.wd))
+}
+
+func (w *Inotify) Close() error {
+	w.poller.Close()
+	return w.file.Close()
+}
+
+func (w *Inotify) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !xerrors.Is(err, os.ErrClosed) {
+				w.log.Error("stopped reading events", "error", err)
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			w.handle(event.Wd, event.Mask)
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+		}
+	}
+}
+
+func (w *Inotify) handle(wd int32, mask uint32) {
+	w.Lock()
+	defer w.Unlock()
+
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		// events were lost, so wake everyone up to check their paths
+		for _, iw := range w.watches {
+			notify(iw.ch, Create|Write)
+		}
+		return
+	}
+
+	op := toOp(mask)
+	for _, path := range w.paths[wd] {
+		if op != 0 {
+			notify(w.watches[path].ch, op)
+		}
+
+		if mask&syscall.IN_IGNORED != 0 {
+			delete(w.watches, path)
+		}
+	}
+
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.paths, wd)
+	}
+}
+
+func toOp(mask uint32) Op {
+	var op Op
+	if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		op |= Create
+	}
+	if mask&syscall.IN_MODIFY != 0 {
+		op |= Write
+	}
+	if mask&syscall.IN_ATTRIB != 0 {
+		op |= Chmod
+	}
+	if mask&syscall.IN_DELETE_SELF != 0 {
+		op |= Remove
+	}
+	if mask&syscall.IN_MOVE_SELF != 0 {
+		op |= Rename
+	}
+	return op
+}
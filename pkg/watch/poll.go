@@ -0,0 +1,122 @@
+package watch
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+type polled struct {
+	ch   chan Op
+	info os.FileInfo
+}
+
+// Poller is a Watcher that periodically stats the watched paths. It works on every platform and
+// filesystem, at the cost of latency and wakeups.
+type Poller struct {
+	sync.Mutex
+
+	interval time.Duration
+	paths    map[string]*polled
+	term     chan struct{}
+	once     sync.Once
+}
+
+func NewPoller(interval time.Duration) *Poller {
+	p := new(Poller)
+
+	p.interval = interval
+	p.paths = make(map[string]*polled)
+	p.term = make(chan struct{})
+
+	go p.run()
+
+	return p
+}
+
+func (p *Poller) Watch(path string) (<-chan Op, error) {
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	w := &polled{ch: make(chan Op, 1), info: info}
+
+	p.Lock()
+	p.paths[path] = w
+	p.Unlock()
+
+	return w.ch, nil
+}
+
+func (p *Poller) Unwatch(path string) {
+	p.Lock()
+	delete(p.paths, path)
+	p.Unlock()
+}
+
+func (p *Poller) Close() error {
+	p.once.Do(func() {
+		close(p.term)
+	})
+	return nil
+}
+
+func (p *Poller) run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.term:
+			return
+		case <-ticker.C:
+			p.poll()
+		}
+	}
+}
+
+func (p *Poller) poll() {
+	p.Lock()
+	defer p.Unlock()
+
+	for path, w := range p.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			info = nil
+		}
+
+		op := compare(w.info, info)
+		w.info = info
+
+		if op != 0 {
+			notify(w.ch, op)
+		}
+	}
+}
+
+// compare returns the changes between two snapshots of a path, either of which may be nil if
+// the path did not exist.
+func compare(prev, cur os.FileInfo) Op {
+	switch {
+	case prev == nil && cur == nil:
+		return 0
+	case prev == nil:
+		return Create
+	case cur == nil:
+		return Remove
+	case !os.SameFile(prev, cur):
+		return Rename
+	case cur.IsDir():
+		if !cur.ModTime().Equal(prev.ModTime()) {
+			return Create
+		}
+	case cur.Size() < prev.Size():
+		return Truncate
+	case cur.Size() != prev.Size() || !cur.ModTime().Equal(prev.ModTime()):
+		return Write
+	case cur.Mode() != prev.Mode():
+		return Chmod
+	}
+	return 0
+}
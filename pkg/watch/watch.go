@@ -0,0 +1,70 @@
+// Package watch notifies about changes to files and the contents of directories.
+package watch
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mresvanis/argo/pkg/logging"
+)
+
+// Op describes a set of changes to a watched path.
+type Op uint32
+
+const (
+	Create Op = 1 << iota
+	Write
+	Truncate
+	Remove
+	Rename
+	Chmod
+)
+
+func (op Op) String() string {
+	var ops []string
+	for _, o := range []struct {
+		op   Op
+		name string
+	}{
+		{Create, "create"},
+		{Write, "write"},
+		{Truncate, "truncate"},
+		{Remove, "remove"},
+		{Rename, "rename"},
+		{Chmod, "chmod"},
+	} {
+		if op&o.op != 0 {
+			ops = append(ops, o.name)
+		}
+	}
+	return strings.Join(ops, "|")
+}
+
+// Watcher delivers change notifications for watched files and directories.
+type Watcher interface {
+	// Watch starts watching the specified path and returns the channel where its changes are
+	// delivered. Files notify when they are written, truncated, renamed or removed; directories
+	// notify when entries are created or moved into them. Notifications are coalesced, so a
+	// slow receiver is woken once for several changes.
+	Watch(path string) (<-chan Op, error)
+
+	// Unwatch stops watching the specified path.
+	Unwatch(path string)
+
+	// Close stops watching every path and releases the watcher resources.
+	Close() error
+}
+
+// notify delivers op to ch without blocking; a pending notification already wakes the receiver.
+func notify(ch chan Op, op Op) {
+	select {
+	case ch <- op:
+	default:
+	}
+}
+
+// New returns the most efficient Watcher available on the platform, falling back to polling the
+// watched paths every interval.
+func New(interval time.Duration, log *logging.Logger) Watcher {
+	return newWatcher(interval, log)
+}
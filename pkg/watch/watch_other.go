@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+import (
+	"time"
+
+	"github.com/mresvanis/argo/pkg/logging"
+)
+
+func newWatcher(interval time.Duration, log *logging.Logger) Watcher {
+	return NewPoller(interval)
+}
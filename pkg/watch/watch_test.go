@@ -0,0 +1,72 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	var watchers = []struct {
+		name    string
+		watcher Watcher
+	}{
+		{"default", New(10*time.Millisecond, nil)},
+		{"poller", NewPoller(10 * time.Millisecond)},
+	}
+
+	for _, tt := range watchers {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.watcher.Close()
+
+			dir, err := ioutil.TempDir("", "watch")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			dirCh, err := tt.watcher.Watch(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(dir, "test.log")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			expectOp(t, dirCh, Create)
+
+			fileCh, err := tt.watcher.Watch(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f.WriteString("line\n")
+			expectOp(t, fileCh, Write)
+
+			// a poller only sees that the path is gone
+			os.Rename(path, path+".1")
+			expectOp(t, fileCh, Rename|Remove)
+
+			tt.watcher.Unwatch(path)
+			tt.watcher.Unwatch(dir)
+		})
+	}
+}
+
+func expectOp(t *testing.T, ch <-chan Op, op Op) {
+	t.Helper()
+
+	select {
+	case got := <-ch:
+		if got&op == 0 {
+			t.Fatalf("expected %s, got %s", op, got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected %s, got nothing", op)
+	}
+}